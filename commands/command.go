@@ -4,14 +4,20 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/suconghou/netdisk/config"
+	"github.com/suconghou/netdisk/layers/baidudisk"
 	"github.com/suconghou/netdisk/layers/fslayer"
+	"github.com/suconghou/netdisk/loader"
 	"github.com/suconghou/netdisk/middleware"
 	"github.com/suconghou/netdisk/tools"
 	"github.com/suconghou/netdisk/util"
@@ -103,8 +109,13 @@ func Rm() {
 
 // Get do a simple download
 func Get() {
-	if len(os.Args) >= 3 && !utilgo.IsURL(os.Args[2], true) {
-		saveas, err := utilgo.GetStorePath(os.Args[2])
+	if args := positionalArgs(os.Args[2:]); len(args) > 0 && !utilgo.IsURL(args[0], true) {
+		saveas, err := utilgo.GetStorePath(args[0])
+		if err != nil {
+			util.Log.Print(err)
+			return
+		}
+		opt, err := loadOption()
 		if err != nil {
 			util.Log.Print(err)
 			return
@@ -114,7 +125,7 @@ func Get() {
 			util.Log.Print(err)
 			return
 		}
-		err = fslayer.Get(os.Args[2], saveas, transport)
+		err = fslayer.Get(args[0], saveas, opt, transport)
 		if err != nil {
 			util.Log.Print(err)
 		}
@@ -144,49 +155,249 @@ func Put() {
 	}
 	if err == nil {
 		defer file.Close()
-		err = fslayer.Put(fileName, overwrite, file)
+		var limiter *util.Limiter
+		if limiter, err = util.GetLimiter(); err == nil {
+			fslayer.SetLimiter(limiter)
+			err = fslayer.Put(fileName, overwrite, file)
+		}
 	}
 	if err != nil {
 		util.Log.Print(err)
 	}
 }
 
-// Wget url like wget
-func Wget() {
-	if len(os.Args) >= 3 && utilgo.IsURL(os.Args[2], true) {
-		var (
-			saveas, err = utilgo.GetStorePath(os.Args[2])
-		)
-		if err != nil {
-			util.Log.Print(err)
-			return
+// Wget url like wget, several urls of the same file can be given as mirrors
+// return 1 if the download failed and 2 for wrong args
+func Wget() int {
+	var (
+		urls      []string
+		mirrors   = map[string]int{}
+		saveas    string
+		metalinks []string
+	)
+	if utilgo.HasFlag(os.Args, "-i") {
+		return WgetList()
+	}
+	if utilgo.HasFlag(os.Args, "-r") {
+		return WgetMirror()
+	}
+	opt, err := loadOption()
+	if err != nil {
+		util.Log.Print(err)
+		return 2
+	}
+	for _, arg := range positionalArgs(os.Args[2:]) {
+		if strings.HasSuffix(strings.ToLower(arg), ".meta4") {
+			metalinks = append(metalinks, arg)
+			continue
 		}
-		transport, err := util.GetProxy()
-		if err != nil {
-			util.Log.Print(err)
-			return
+		if !utilgo.IsURL(arg, true) {
+			util.Log.Printf("invalid url %s", arg)
+			return 2
+		}
+		if _, ok := mirrors[arg]; !ok {
+			urls = append(urls, arg)
+		}
+		mirrors[arg] = 1
+	}
+	if utilgo.HasFlag(os.Args, "--mirrors") {
+		file, err := utilgo.GetParam(os.Args, "--mirrors")
+		if err == nil {
+			urls, err = readMirrors(file, urls, mirrors)
 		}
-		err = fslayer.WgetURL(os.Args[2], saveas, transport)
 		if err != nil {
 			util.Log.Print(err)
+			return 2
 		}
+	}
+	if len(urls) == 0 && len(metalinks) == 0 {
+		util.Log.Print("Usage:disk wget url [url2 ...] [-o file] [--mirrors file]\n       disk wget file.meta4 [-o file]")
+		return 2
+	}
+	if len(urls) > 0 && len(metalinks) > 0 || len(metalinks) > 1 {
+		util.Log.Print("a metalink can not be used with other urls or metalinks")
+		return 2
+	}
+	transport, err := util.GetProxy()
+	if err != nil {
+		util.Log.Print(err)
+		return 2
+	}
+	if utilgo.HasFlag(os.Args, "-o") {
+		saveas, err = utilgo.GetParam(os.Args, "-o")
+		if err == nil && saveas == "" {
+			err = fmt.Errorf("-o needs a file name")
+		}
+	} else if len(urls) > 0 {
+		saveas, err = fslayer.FileName(urls[0], opt, transport)
+	}
+	if err == nil && len(urls) > 0 {
+		saveas, err = outputName(saveas, nil)
+	}
+	if err != nil {
+		util.Log.Print(err)
+		return 1
+	}
+	if saveas == "" && len(urls) > 0 {
+		return 0
+	}
+	if len(metalinks) > 0 {
+		err = fslayer.WgetMetalink(metalinks[0], saveas, opt, transport)
 	} else {
-		util.Log.Print("Usage:disk wget url")
+		if len(mirrors) > 1 {
+			opt.Mirrors = mirrors
+		}
+		err = fslayer.WgetURL(urls[0], saveas, opt, transport)
 	}
+	if err != nil {
+		util.Log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// WgetMirror download a site recursively, return 1 if any file failed and 2 for wrong args
+func WgetMirror() int {
+	var (
+		mopt = &tools.MirrorOption{Depth: 5, Dir: ".", Workers: 4, Large: 8 << 20}
+		args = positionalArgs(os.Args[2:])
+	)
+	opt, err := loadOption()
+	if err == nil {
+		for _, item := range []struct {
+			flag  string
+			value *int
+		}{{"-l", &mopt.Depth}, {"-j", &mopt.Workers}} {
+			if utilgo.HasFlag(os.Args, item.flag) {
+				var v string
+				if v, err = utilgo.GetParam(os.Args, item.flag); err == nil {
+					*item.value, err = strconv.Atoi(v)
+				}
+				if err != nil || *item.value < 0 {
+					err = fmt.Errorf("%s needs a number", item.flag)
+					break
+				}
+			}
+		}
+	}
+	if err == nil && utilgo.HasFlag(os.Args, "-P") {
+		mopt.Dir, err = utilgo.GetParam(os.Args, "-P")
+	}
+	if err == nil && len(args) != 1 {
+		err = fmt.Errorf("Usage:disk wget -r [-l 5] [-P dir] [-j 4] [--no-parent] [--no-robots] url")
+	}
+	if err == nil {
+		mopt.Transport, err = util.GetProxy()
+	}
+	if err != nil {
+		util.Log.Print(err)
+		return 2
+	}
+	opt.Quiet = true
+	mopt.Header = opt.Header
+	mopt.NoParent = utilgo.HasFlag(os.Args, "--no-parent")
+	mopt.NoRobots = utilgo.HasFlag(os.Args, "--no-robots")
+	mopt.Load = func(url string, saveas string) error {
+		return fslayer.WgetURL(url, saveas, opt, mopt.Transport)
+	}
+	if err = tools.Mirror(args[0], mopt); err != nil {
+		util.Log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// outputName apply --no-clobber and --auto-rename to an existing file, return "" if it should be skipped
+func outputName(saveas string, used func(string) bool) (string, error) {
+	var (
+		noClobber  = utilgo.HasFlag(os.Args, "--no-clobber")
+		autoRename = utilgo.HasFlag(os.Args, "--auto-rename")
+	)
+	if noClobber && autoRename {
+		return "", fmt.Errorf("--no-clobber and --auto-rename can not be used together")
+	}
+	if noClobber && loader.Exists(saveas) {
+		util.Log.Printf("%s 已存在, 跳过", saveas)
+		return "", nil
+	}
+	if autoRename {
+		return loader.FreeName(saveas, func(n string) bool {
+			return loader.Exists(n) || used != nil && used(n)
+		}), nil
+	}
+	return saveas, nil
+}
+
+// readMirrors read a mirror list, each line is a url and an optional weight
+func readMirrors(file string, urls []string, mirrors map[string]int) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if !utilgo.IsURL(fields[0], true) || len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d invalid mirror, should be url [weight]", file, i+1)
+		}
+		weight := 1
+		if len(fields) == 2 {
+			if weight, err = strconv.Atoi(fields[1]); err != nil || weight < 1 {
+				return nil, fmt.Errorf("%s:%d invalid weight %s", file, i+1, fields[1])
+			}
+		}
+		if _, ok := mirrors[fields[0]]; !ok {
+			urls = append(urls, fields[0])
+		}
+		mirrors[fields[0]] = weight
+	}
+	return urls, nil
+}
+
+// positionalArgs return args which are not flags or flag values, the value flags are declared in the registry, args after -- are all positional
+func positionalArgs(args []string) []string {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(rest, args[i+1:]...)
+		}
+		if current != nil && current.takesValue(args[i]) {
+			i++
+		} else if !strings.HasPrefix(args[i], "-") || args[i] == "-" {
+			rest = append(rest, args[i])
+		}
+	}
+	return rest
 }
 
 // Play play a url or file(pcs file)
 func Play() {
-	if len(os.Args) >= 3 {
+	if utilgo.HasFlag(os.Args, "-r") {
+		PlayDir()
+		return
+	}
+	if utilgo.HasFlag(os.Args, "--stream") {
+		PlayStream()
+		return
+	}
+	if args := positionalArgs(os.Args[2:]); len(args) > 0 {
 		var (
 			saveas string
 			err    error
 			stdout = utilgo.HasFlag(os.Args, "--stdout")
 		)
 		if stdout {
-			util.Log.SetOutput(os.Stderr)
+			util.Log.SetOutput(util.Redact(os.Stderr))
+			defer util.Log.SetOutput(util.Redact(os.Stdout))
+		}
+		saveas, err = utilgo.GetStorePath(args[0])
+		if err != nil {
+			util.Log.Print(err)
+			return
 		}
-		saveas, err = utilgo.GetStorePath(os.Args[2])
+		opt, err := loadOption()
 		if err != nil {
 			util.Log.Print(err)
 			return
@@ -197,13 +408,13 @@ func Play() {
 			return
 		}
 		util.Log.Print("Playing " + saveas)
-		if utilgo.IsURL(os.Args[2], true) {
-			err = fslayer.PlayURL(os.Args[2], saveas, stdout, transport)
+		if utilgo.IsURL(args[0], true) {
+			err = fslayer.PlayURL(args[0], saveas, stdout, opt, transport)
 			if err != nil {
 				util.Log.Print(err)
 			}
 		} else {
-			err = fslayer.Play(os.Args[2], saveas, stdout, transport)
+			err = fslayer.Play(args[0], saveas, stdout, opt, transport)
 			if err != nil {
 				util.Log.Print(err)
 			}
@@ -213,6 +424,243 @@ func Play() {
 	}
 }
 
+// PlayStream play the HLS transcoded by the backend
+func PlayStream() {
+	var (
+		t    string
+		args = positionalArgs(os.Args[2:])
+		err  error
+	)
+	if len(args) != 1 || utilgo.IsURL(args[0], true) {
+		util.Log.Print("Usage:disk play --stream [--type M3U8_AUTO_480] filepath")
+		return
+	}
+	if utilgo.HasFlag(os.Args, "--type") {
+		t, err = utilgo.GetParam(os.Args, "--type")
+	}
+	if err == nil {
+		err = fslayer.PlayStream(args[0], t)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// Thumb save the thumbnail of image or video
+func Thumb() {
+	var (
+		size        string
+		saveas      string
+		width       int
+		height      int
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+	)
+	CommandLine.StringVar(&size, "s", "800x600", "size WxH, at most 1600x1600")
+	CommandLine.StringVar(&saveas, "o", "", "save as")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil && len(args) != 1 {
+		err = fmt.Errorf("Usage:disk thumb filepath [-s WxH] [-o file.jpg]")
+	}
+	if err == nil {
+		if n, _ := fmt.Sscanf(size, "%dx%d", &width, &height); n != 2 {
+			err = fmt.Errorf("invalid size %s , should be like 800x600", size)
+		} else {
+			width, height, err = baidudisk.ThumbSize(width, height)
+		}
+	}
+	if err == nil && saveas == "" {
+		name := path.Base(args[0])
+		saveas = strings.TrimSuffix(name, path.Ext(name)) + ".jpg"
+	}
+	if err == nil {
+		err = fslayer.Thumb(args[0], width, height, saveas)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// Config print or change the config file
+func Config() {
+	var (
+		args  = os.Args[2:]
+		usage = fmt.Errorf("Usage:disk config [list|path|get key|set key value|encrypt|decrypt]")
+		err   error
+	)
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch {
+	case args[0] == "path" && len(args) == 1:
+		p := config.Path()
+		if name := config.Profile(); name != "" {
+			p = p + "  (profile " + name + ")"
+		}
+		if config.SavePath() != config.Path() {
+			p = p + "  (read only, saved to " + config.SavePath() + ")"
+		}
+		util.Log.Print(p)
+	case args[0] == "list" && len(args) == 1:
+		if err = config.Error(); err == nil {
+			b := strings.Builder{}
+			b.WriteString(config.Path())
+			for _, key := range config.Keys() {
+				v, _ := config.Get(key)
+				if config.IsSecret(key) {
+					v = maskSecret(v)
+					if config.Encrypted() && v != "" {
+						v += "  (encrypted)"
+					}
+				}
+				b.WriteString(fmt.Sprintf("\n%-12s = %s", key, v))
+				if config.Overridden(key) {
+					b.WriteString("  (" + config.EnvName(key) + ")")
+				}
+			}
+			util.Log.Print(b.String())
+		}
+	case args[0] == "get" && len(args) == 2:
+		var v string
+		if config.IsSecret(args[1]) {
+			err = config.Unlock()
+		}
+		if err == nil {
+			v, err = config.Get(args[1])
+		}
+		if err == nil {
+			// 明确查询的密钥原样输出
+			util.Raw.Print(v)
+		}
+	case args[0] == "set" && (len(args) == 2 || len(args) == 3):
+		var value string
+		if len(args) == 3 {
+			value = args[2]
+		}
+		if err = config.Set(args[1], value); err == nil {
+			err = config.Cfg.Save()
+		}
+		if err == nil && config.Overridden(args[1]) {
+			util.Log.Printf("%s is set by env, the saved value is used once it is unset", args[1])
+		}
+	case args[0] == "encrypt" && len(args) == 1:
+		if err = config.Error(); err == nil {
+			err = config.Unlock()
+		}
+		if err == nil {
+			var pass string
+			if pass, err = config.ReadPassphrase(true); err == nil {
+				err = config.Encrypt(pass)
+			}
+		}
+		if err == nil {
+			if err = config.Cfg.Save(); err == nil {
+				util.Log.Print("已加密 " + config.Path())
+			}
+		}
+	case args[0] == "decrypt" && len(args) == 1:
+		if err = config.Error(); err == nil {
+			err = config.Decrypt()
+		}
+		if err == nil {
+			if err = config.Cfg.Save(); err == nil {
+				util.Log.Print("已解密 " + config.Path())
+			}
+		}
+	default:
+		err = usage
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// maskSecret hide a secret completely, only whether it is set is shown
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "******"
+}
+
+// Changes print the created modified and deleted entries since the last cursor
+func Changes() {
+	var (
+		cursor      string
+		init        bool
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+	)
+	CommandLine.StringVar(&cursor, "since", "", "cursor, default is the stored one")
+	CommandLine.BoolVar(&init, "init", false, "only store the current cursor")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil && len(args) != 0 {
+		err = fmt.Errorf("Usage:disk changes [--since cursor] [--init]")
+	}
+	if err == nil {
+		err = fslayer.Changes(cursor, init)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// PlayDir play the media files of a remote dir as a playlist
+func PlayDir() {
+	args := positionalArgs(os.Args[2:])
+	if len(args) != 1 {
+		util.Log.Print("Usage:disk play -r remote/dir")
+		return
+	}
+	opt, err := loadOption()
+	if err != nil {
+		util.Log.Print(err)
+		return
+	}
+	transport, err := util.GetProxy()
+	if err == nil {
+		err = fslayer.PlayDir(args[0], opt, transport)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// Cat write remote file to stdout, head and tail write the first or last bytes
+func Cat() {
+	var (
+		count       string
+		threads     int
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+		length      = int64(-1)
+		cmd         = os.Args[1]
+	)
+	util.Log.SetOutput(util.Redact(os.Stderr))
+	defer util.Log.SetOutput(util.Redact(os.Stdout))
+	CommandLine.StringVar(&count, "c", "1K", "bytes to print like 100 10K 2M")
+	CommandLine.IntVar(&threads, "t", 4, "concurrent connections")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil && len(args) != 1 {
+		err = fmt.Errorf("Usage:disk %s filepath", utilgo.BoolString(cmd == "cat", "cat", cmd+" [-c bytes]"))
+	}
+	if err == nil && cmd != "cat" {
+		var n uint64
+		n, err = util.ParseSize(count)
+		length = int64(n)
+	}
+	if err == nil {
+		var transport *http.Transport
+		transport, err = util.GetProxy()
+		if err == nil {
+			err = fslayer.Cat(args[0], length, cmd == "tail", threads, os.Stdout, transport)
+		}
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
 // Info print the backend info or file info
 func Info() {
 	if len(os.Args) >= 3 {
@@ -255,11 +703,6 @@ func Hash(t string) {
 	}
 }
 
-// Help print the help message
-func Help() {
-	util.Log.Print(os.Args[0] + " ls info mv cp get put wget play rm mkdir pwd hash config empty search task ")
-}
-
 // Task list current backend task
 func Task() {
 	var err error
@@ -289,6 +732,256 @@ func Search() {
 	}
 }
 
+// Du print recursive size of sub dirs
+func Du() {
+	var (
+		depth       int
+		workers     int
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+	)
+	CommandLine.IntVar(&depth, "d", 1, "max depth to print")
+	CommandLine.IntVar(&workers, "j", 8, "concurrent workers")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil {
+		if len(args) > 1 {
+			util.Log.Print("Usage:disk du [-d depth] [-j workers] path")
+			return
+		}
+		var dir string
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		err = fslayer.Du(dir, depth, workers)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// Tree print the hierarchy of dir
+func Tree() {
+	var (
+		depth       int
+		workers     int
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+	)
+	CommandLine.IntVar(&depth, "L", -1, "max depth, -1 means no limit")
+	CommandLine.IntVar(&workers, "j", 8, "concurrent workers")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil {
+		if len(args) > 1 {
+			util.Log.Print("Usage:disk tree [-L depth] [-j workers] path")
+			return
+		}
+		var dir string
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		err = fslayer.Tree(dir, depth, workers)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// Find walk the dir and filter files
+func Find() {
+	var (
+		workers     int
+		print0      bool
+		del         bool
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+		filter      = filterFlags(CommandLine)
+	)
+	CommandLine.IntVar(&workers, "j", 8, "concurrent workers")
+	CommandLine.BoolVar(&print0, "print0", false, "print paths separated by NUL")
+	CommandLine.BoolVar(&del, "delete", false, "delete matched files")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil && len(args) > 1 {
+		err = fmt.Errorf("Usage:disk find path [-name glob] [-regex re] [-min-size 2G] [-max-size 4G] [-newer 30d] [-older 1y] [-type f|d] [-ext mp4,mkv] [-md5 hash] [-delete] [-print0]")
+	}
+	var f *baidudisk.Filter
+	if err == nil {
+		f, err = filter()
+	}
+	if err == nil {
+		var dir string
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		err = fslayer.Find(dir, f, workers, print0, del)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// Index build or query the local index of the remote tree
+func Index() {
+	var (
+		full        bool
+		print0      bool
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+		filter      = filterFlags(CommandLine)
+		usage       = fmt.Errorf("Usage:disk index build [-full]\n      disk index query path [-name glob] [-regex re] [-min-size 2G] [-max-size 4G] [-newer 30d] [-older 1y] [-type f|d] [-ext mp4,mkv] [-md5 hash] [-print0]")
+	)
+	CommandLine.BoolVar(&full, "full", false, "rebuild the whole index")
+	CommandLine.BoolVar(&print0, "print0", false, "print paths separated by NUL")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil && len(args) == 0 {
+		err = usage
+	}
+	if err == nil {
+		switch {
+		case args[0] == "build" && len(args) == 1:
+			err = fslayer.IndexBuild(full)
+		case args[0] == "query" && len(args) <= 2:
+			var (
+				f   *baidudisk.Filter
+				dir string
+			)
+			if len(args) == 2 {
+				dir = args[1]
+			}
+			if f, err = filter(); err == nil {
+				err = fslayer.IndexQuery(dir, f, print0)
+			}
+		default:
+			err = usage
+		}
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// filterFlags define the find conditions, the returned func build the filter after parsing
+func filterFlags(CommandLine *flag.FlagSet) func() (*baidudisk.Filter, error) {
+	var (
+		name, regex string
+		minSize     string
+		maxSize     string
+		newer       string
+		older       string
+		fileType    string
+		exts        string
+		md5         string
+	)
+	CommandLine.StringVar(&name, "name", "", "name glob like *.mp4")
+	CommandLine.StringVar(&regex, "regex", "", "name regexp")
+	CommandLine.StringVar(&minSize, "min-size", "", "min size like 2G")
+	CommandLine.StringVar(&maxSize, "max-size", "", "max size like 100M")
+	CommandLine.StringVar(&newer, "newer", "", "modified after date or age like 2020-01-01 30d")
+	CommandLine.StringVar(&older, "older", "", "modified before date or age like 2020-01-01 1y")
+	CommandLine.StringVar(&fileType, "type", "", "f for file, d for dir")
+	CommandLine.StringVar(&exts, "ext", "", "extensions like mp4,mkv")
+	CommandLine.StringVar(&md5, "md5", "", "content md5")
+	return func() (*baidudisk.Filter, error) {
+		var (
+			err    error
+			filter = &baidudisk.Filter{MD5: md5}
+		)
+		if name != "" {
+			_, err = path.Match(name, "")
+			filter.Name = name
+		}
+		if err == nil && regex != "" {
+			filter.Regexp, err = regexp.Compile(regex)
+		}
+		if err == nil && minSize != "" {
+			filter.MinSize, err = util.ParseSize(minSize)
+		}
+		if err == nil && maxSize != "" {
+			filter.MaxSize, err = util.ParseSize(maxSize)
+		}
+		if err == nil && newer != "" {
+			filter.After, err = util.ParseTime(newer)
+		}
+		if err == nil && older != "" {
+			filter.Before, err = util.ParseTime(older)
+		}
+		if err == nil && fileType != "" && fileType != "f" && fileType != "d" {
+			err = fmt.Errorf("invalid type %s , should be f or d", fileType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		filter.Type = fileType
+		for _, ext := range strings.Split(exts, ",") {
+			if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+				filter.Exts = append(filter.Exts, ext)
+			}
+		}
+		return filter, nil
+	}
+}
+
+// Dedupe find duplicate files by size and md5
+func Dedupe() {
+	var (
+		keep        string
+		moveTo      string
+		del         bool
+		dryRun      bool
+		workers     int
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+	)
+	CommandLine.StringVar(&keep, "keep", "oldest", "which copy to keep: oldest newest shortest")
+	CommandLine.StringVar(&moveTo, "move", "", "move duplicates to this dir")
+	CommandLine.BoolVar(&del, "delete", false, "delete duplicates")
+	CommandLine.BoolVar(&dryRun, "dry-run", false, "only print what would be done")
+	CommandLine.IntVar(&workers, "j", 8, "concurrent workers")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil {
+		switch {
+		case len(args) > 1:
+			err = fmt.Errorf("Usage:disk dedupe path [-keep oldest|newest|shortest] [-delete|-move dir] [-dry-run]")
+		case keep != "oldest" && keep != "newest" && keep != "shortest":
+			err = fmt.Errorf("invalid keep %s , should be oldest newest or shortest", keep)
+		case del && moveTo != "":
+			err = fmt.Errorf("-delete and -move can not be used together")
+		}
+	}
+	if err == nil {
+		var dir string
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		err = fslayer.Dedupe(dir, keep, moveTo, del, dryRun, workers)
+	}
+	if err != nil {
+		util.Log.Print(err)
+	}
+}
+
+// Verify compare local files with remote checksums, return 1 if any differs and 2 for wrong args
+func Verify() int {
+	var (
+		workers     int
+		ferr        flag.ErrorHandling
+		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
+	)
+	CommandLine.IntVar(&workers, "j", 8, "concurrent workers")
+	args, err := parseFlags(CommandLine, os.Args[2:])
+	if err == nil && len(args) != 2 {
+		err = fmt.Errorf("Usage:disk verify local remote")
+	}
+	if err != nil {
+		util.Log.Print(err)
+		return 2
+	}
+	if err = fslayer.Verify(args[0], args[1], workers); err != nil {
+		util.Log.Print(err)
+		return 1
+	}
+	return 0
+}
+
 // Empty clear cache data
 func Empty() {
 	fslayer.Empty()
@@ -336,14 +1029,17 @@ func Proxy() {
 	var (
 		port        int
 		socks       string
+		rate        string
 		ferr        flag.ErrorHandling
 		l           net.Listener
 		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
 		dialer      = proxy.FromEnvironment()
 		d           proxy.Dialer
+		limiter     *util.Limiter
 	)
 	CommandLine.IntVar(&port, "p", 8123, "listen port")
 	CommandLine.StringVar(&socks, "socks", "", "socks proxy")
+	CommandLine.StringVar(&rate, "limit-rate", "", "speed limit of all connections")
 	err := CommandLine.Parse(os.Args[2:])
 	if err == nil {
 		if socks != "" {
@@ -352,6 +1048,9 @@ func Proxy() {
 				dialer = d
 			}
 		}
+		if err == nil {
+			limiter, err = util.ParseLimiter(rate)
+		}
 		if err != nil {
 			util.Log.Print(err)
 			return
@@ -368,7 +1067,7 @@ func Proxy() {
 								util.Log.Print(err)
 							}
 						}()
-						err := middleware.ProxySocks(client, dialer)
+						err := middleware.ProxySocks(client, dialer, limiter)
 						if err != nil && err != io.EOF {
 							util.Log.Print(err)
 						}
@@ -392,15 +1091,18 @@ func HTTPProxy() {
 		proxy       string
 		socks       string
 		header      string
+		rate        string
 		ferr        flag.ErrorHandling
 		CommandLine = flag.NewFlagSet(os.Args[1], ferr)
 		transport   *http.Transport
+		limiter     *util.Limiter
 	)
 	CommandLine.IntVar(&port, "p", 8123, "listen port")
 	CommandLine.StringVar(&url, "u", "http://127.0.0.1:8080", "reverse url")
 	CommandLine.StringVar(&proxy, "proxy", "", "http proxy")
 	CommandLine.StringVar(&socks, "socks", "", "socks proxy")
 	CommandLine.StringVar(&header, "header", "", "allow headers")
+	CommandLine.StringVar(&rate, "limit-rate", "", "speed limit of all responses")
 	err := CommandLine.Parse(os.Args[2:])
 	if err == nil {
 		if socks != "" {
@@ -409,7 +1111,10 @@ func HTTPProxy() {
 			transport, err = util.MakeHTTPProxy(proxy, util.GetTLSConfig())
 		}
 		if err == nil {
-			err = tools.HTTPProxy(port, url, transport, header)
+			limiter, err = util.ParseLimiter(rate)
+		}
+		if err == nil {
+			err = tools.HTTPProxy(port, url, transport, header, limiter)
 		}
 	}
 	if err != nil {
@@ -478,11 +1183,114 @@ func Network() {
 
 }
 
+// loadOption parse the download flags of os.Args
+// --cookie --refer --ua --header for http headers
+// --range:start-end for a certain range
+// --fast --slow for threads, --fat --thin for chunk size
+func loadOption() (*fslayer.LoadOption, error) {
+	var (
+		opt  = fslayer.DefaultLoadOption()
+		args = os.Args
+	)
+	if utilgo.HasFlag(args, "--fast") && utilgo.HasFlag(args, "--slow") {
+		return nil, fmt.Errorf("--fast and --slow can not be used together")
+	}
+	if utilgo.HasFlag(args, "--fat") && utilgo.HasFlag(args, "--thin") {
+		return nil, fmt.Errorf("--fat and --thin can not be used together")
+	}
+	if utilgo.HasFlag(args, "--fast") {
+		opt.Thread = 16
+	} else if utilgo.HasFlag(args, "--slow") {
+		opt.Thread = 4
+	}
+	if utilgo.HasFlag(args, "--fat") {
+		opt.Chunk = 8388608
+	} else if utilgo.HasFlag(args, "--thin") {
+		opt.Chunk = 262144
+	}
+	for _, item := range [][2]string{{"--cookie", "Cookie"}, {"--refer", "Referer"}, {"--ua", "User-Agent"}} {
+		if utilgo.HasFlag(args, item[0]) {
+			v, err := utilgo.GetParam(args, item[0])
+			if err != nil || v == "" || strings.HasPrefix(v, "--") {
+				return nil, fmt.Errorf("%s needs a value", item[0])
+			}
+			opt.Header.Set(item[1], v)
+		}
+	}
+	for _, item := range [][2]string{{"--md5", "md5"}, {"--sha256", "sha-256"}} {
+		if utilgo.HasFlag(args, item[0]) {
+			v, err := utilgo.GetParam(args, item[0])
+			if err != nil || !regexp.MustCompile(`^[0-9a-fA-F]+$`).MatchString(v) {
+				return nil, fmt.Errorf("%s needs a hex checksum", item[0])
+			}
+			if opt.Hashes == nil {
+				opt.Hashes = map[string]string{}
+			}
+			opt.Hashes[item[1]] = v
+		}
+	}
+	limiter, err := util.GetLimiter()
+	if err != nil {
+		return nil, err
+	}
+	opt.Limiter = limiter
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--header":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--header needs a value like \"Name: value\"")
+			}
+			i++
+			kv := strings.SplitN(args[i], ":", 2)
+			k := strings.TrimSpace(kv[0])
+			if len(kv) != 2 || k == "" || strings.ContainsAny(k, " \t") {
+				return nil, fmt.Errorf("invalid header %s , should be like \"Name: value\"", args[i])
+			}
+			opt.Header.Add(k, strings.TrimSpace(kv[1]))
+		case strings.HasPrefix(arg, "--range:"):
+			r := strings.SplitN(strings.TrimPrefix(arg, "--range:"), "-", 2)
+			if len(r) != 2 {
+				return nil, fmt.Errorf("invalid range %s , should be like --range:0-1024 or --range:1024-", arg)
+			}
+			start, err := strconv.ParseInt(r[0], 10, 64)
+			if err != nil || start < 0 {
+				return nil, fmt.Errorf("invalid range start %s", r[0])
+			}
+			var end int64
+			if r[1] != "" {
+				end, err = strconv.ParseInt(r[1], 10, 64)
+				if err != nil || end < start || end == 0 {
+					return nil, fmt.Errorf("invalid range end %s", r[1])
+				}
+			}
+			opt.Ranged, opt.Start, opt.End = true, start, end
+		}
+	}
+	return opt, nil
+}
+
+// parseFlags parse flags which may be mixed with positional args
+func parseFlags(CommandLine *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := CommandLine.Parse(args); err != nil {
+			return nil, err
+		}
+		args = CommandLine.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
 // Usage print help message
 func Usage() {
 	if len(os.Args) > 1 && os.Args[1] == "-v" {
 		util.Log.Print(os.Args[0] + " version: disk/" + config.Version + "\n" + config.ReleaseURL)
 	} else {
-		Help()
+		printCommands()
 	}
 }
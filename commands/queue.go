@@ -0,0 +1,310 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/suconghou/netdisk/layers/fslayer"
+	"github.com/suconghou/netdisk/loader"
+	"github.com/suconghou/netdisk/util"
+	"github.com/suconghou/utilgo"
+)
+
+// FailedSuffix is appended to the input list for the failed lines
+const FailedSuffix = ".failed"
+
+// queueItem is one line of the wget input list
+type queueItem struct {
+	line   string
+	url    string
+	saveas string
+	header http.Header
+	hashes map[string]string
+	ok     bool
+	skip   bool
+	size   int64
+	cost   time.Duration
+	err    error
+}
+
+// WgetList download the urls listed in a file or stdin, several files at the same time
+// return 1 if any line failed and 2 for wrong args
+func WgetList() int {
+	var (
+		jobs  = 3
+		input string
+		items []queueItem
+	)
+	opt, err := loadOption()
+	if err == nil {
+		input, err = utilgo.GetParam(os.Args, "-i")
+	}
+	if err == nil && utilgo.HasFlag(os.Args, "-j") {
+		var v string
+		if v, err = utilgo.GetParam(os.Args, "-j"); err == nil {
+			if jobs, err = strconv.Atoi(v); err == nil && jobs < 1 {
+				err = fmt.Errorf("-j should be greater than 0")
+			}
+		}
+	}
+	if err == nil && input == "" {
+		err = fmt.Errorf("Usage:disk wget -i list.txt|- [-j 3] [--limit-rate 2M]")
+	}
+	if err == nil {
+		items, err = readInput(input)
+	}
+	if err != nil {
+		util.Log.Print(err)
+		return 2
+	}
+	transport, err := util.GetProxy()
+	if err != nil {
+		util.Log.Print(err)
+		return 2
+	}
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, jobs)
+		mu   sync.Mutex
+		done = 0
+		used = map[string]bool{}
+	)
+	for _, item := range items {
+		used[item.saveas] = true
+	}
+	for i := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *queueItem) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			o := *opt
+			o.Quiet = true
+			o.Header = http.Header{}
+			for k, v := range opt.Header {
+				o.Header[k] = v
+			}
+			for k, v := range item.header {
+				o.Header[k] = v
+			}
+			if len(item.hashes) > 0 {
+				o.Hashes = item.hashes
+			}
+			t := time.Now()
+			if item.err = queueName(item, &o, transport, used, &mu); item.err == nil && !item.skip {
+				item.err = fslayer.WgetURL(item.url, item.saveas, &o, transport)
+			}
+			item.cost = time.Since(t)
+			item.ok = item.err == nil
+			if info, err := os.Stat(item.saveas); err == nil && item.ok {
+				item.size = info.Size()
+			}
+			if item.saveas == "" {
+				item.saveas = item.url
+			}
+			mu.Lock()
+			done++
+			if item.skip {
+				util.Log.Printf("[%d/%d] 跳过 %s", done, len(items), item.saveas)
+			} else if item.ok {
+				util.Log.Printf("[%d/%d] 完成 %s", done, len(items), item.saveas)
+			} else {
+				util.Log.Printf("[%d/%d] 失败 %s : %v", done, len(items), item.saveas, item.err)
+			}
+			mu.Unlock()
+		}(&items[i])
+	}
+	wg.Wait()
+	if !printQueue(items, failedPath(input)) {
+		return 1
+	}
+	return 0
+}
+
+// readInput read the list of file, - is stdin
+func readInput(input string) ([]queueItem, error) {
+	if input == "-" {
+		return readQueue(os.Stdin)
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readQueue(f)
+}
+
+// queueName resolve the file name of item and reserve it, the same name is not given to two items
+func queueName(item *queueItem, opt *fslayer.LoadOption, transport *http.Transport, used map[string]bool, mu *sync.Mutex) error {
+	if item.saveas == "" {
+		name, err := fslayer.FileName(item.url, opt, transport)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		name = loader.FreeName(name, func(n string) bool { return used[n] })
+		used[name] = true
+		item.saveas = name
+	} else {
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	name, err := outputName(item.saveas, func(n string) bool { return used[n] && n != item.saveas })
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		item.skip = true
+		return nil
+	}
+	used[name] = true
+	item.saveas = name
+	return nil
+}
+
+// readQueue parse the input list, each line is url [name] [-o name] [--header "Name: value"] ...
+func readQueue(r io.Reader) ([]queueItem, error) {
+	var (
+		items   []queueItem
+		saved   = map[string]int{}
+		scanner = bufio.NewScanner(r)
+		n       = 0
+	)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		item, err := parseQueueLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if i, ok := saved[item.saveas]; ok && item.saveas != "" {
+			return nil, fmt.Errorf("line %d: %s is also saved by line %d", n, item.saveas, i)
+		}
+		saved[item.saveas] = n
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no url found")
+	}
+	return items, nil
+}
+
+func parseQueueLine(line string) (queueItem, error) {
+	var (
+		item = queueItem{line: line, header: http.Header{}, hashes: map[string]string{}}
+		args = util.SplitArgs(line)
+		hex  = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			switch {
+			case item.url == "":
+				if !utilgo.IsURL(arg, true) {
+					return item, fmt.Errorf("invalid url %s", arg)
+				}
+				item.url = arg
+			case item.saveas == "":
+				item.saveas = arg
+			default:
+				return item, fmt.Errorf("unexpected %s", arg)
+			}
+			continue
+		}
+		if i+1 >= len(args) {
+			return item, fmt.Errorf("%s needs a value", arg)
+		}
+		i++
+		v := args[i]
+		switch arg {
+		case "-o":
+			item.saveas = v
+		case "--header":
+			kv := strings.SplitN(v, ":", 2)
+			k := strings.TrimSpace(kv[0])
+			if len(kv) != 2 || k == "" || strings.ContainsAny(k, " \t") {
+				return item, fmt.Errorf("invalid header %s , should be like \"Name: value\"", v)
+			}
+			item.header.Add(k, strings.TrimSpace(kv[1]))
+		case "--cookie":
+			item.header.Set("Cookie", v)
+		case "--refer":
+			item.header.Set("Referer", v)
+		case "--ua":
+			item.header.Set("User-Agent", v)
+		case "--md5", "--sha256":
+			if !hex.MatchString(v) {
+				return item, fmt.Errorf("%s needs a hex checksum", arg)
+			}
+			item.hashes[utilgo.BoolString(arg == "--md5", "md5", "sha-256")] = v
+		default:
+			return item, fmt.Errorf("unknown flag %s", arg)
+		}
+	}
+	if item.url == "" {
+		return item, fmt.Errorf("no url")
+	}
+	return item, nil
+}
+
+// failedPath return where the failed lines are written, a failed list is rewritten in place
+func failedPath(input string) string {
+	if input == "-" {
+		return "wget" + FailedSuffix
+	}
+	if strings.HasSuffix(input, FailedSuffix) {
+		return input
+	}
+	return input + FailedSuffix
+}
+
+// printQueue print the status table and write the failed lines, return false if any failed
+func printQueue(items []queueItem, failedFile string) bool {
+	var (
+		b      = strings.Builder{}
+		failed []string
+	)
+	for _, item := range items {
+		status := "OK"
+		if item.skip {
+			status = "SKIPPED"
+		} else if !item.ok {
+			status = "FAILED"
+			failed = append(failed, item.line)
+		}
+		b.WriteString(fmt.Sprintf("%-8s%-10s%-10s%s\n", status, utilgo.ByteFormat(uint64(item.size)), item.cost.Round(time.Second), item.saveas))
+		if item.err != nil {
+			b.WriteString(fmt.Sprintf("        %v\n", item.err))
+		}
+	}
+	b.WriteString(fmt.Sprintf("共 %d 个文件 %d 个失败", len(items), len(failed)))
+	util.Log.Print(b.String())
+	if len(failed) == 0 {
+		os.Remove(failedFile)
+		return true
+	}
+	if err := ioutil.WriteFile(failedFile, []byte(strings.Join(failed, "\n")+"\n"), 0644); err != nil {
+		util.Log.Print(err)
+		return false
+	}
+	util.Log.Printf("失败记录已写入 %s , 使用 disk wget -i %s 重试", failedFile, failedFile)
+	return false
+}
@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/suconghou/netdisk/util"
+)
+
+func TestParseQueueLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		url    string
+		saveas string
+		header http.Header
+		hashes map[string]string
+		err    string
+	}{
+		{line: "http://a/b.zip", url: "http://a/b.zip"},
+		{line: "http://a/b.zip b.zip", url: "http://a/b.zip", saveas: "b.zip"},
+		{line: `http://a/b.zip "my file.zip"`, url: "http://a/b.zip", saveas: "my file.zip"},
+		{line: `http://a/b.zip my\ file.zip`, url: "http://a/b.zip", saveas: "my file.zip"},
+		{line: "-o c.zip http://a/b.zip", url: "http://a/b.zip", saveas: "c.zip"},
+		{
+			line:   `http://a/b --header "X-A: 1" --header 'X-A: 2' --ua curl --refer http://r/ --cookie "k=v; j=w"`,
+			url:    "http://a/b",
+			header: http.Header{"X-A": {"1", "2"}, "User-Agent": {"curl"}, "Referer": {"http://r/"}, "Cookie": {"k=v; j=w"}},
+		},
+		{
+			line:   "http://a/b --md5 D41D8CD98F00B204E9800998ECF8427E --sha256 e3b0c442",
+			url:    "http://a/b",
+			hashes: map[string]string{"md5": "D41D8CD98F00B204E9800998ECF8427E", "sha-256": "e3b0c442"},
+		},
+		{line: "a/b.zip", err: "invalid url a/b.zip"},
+		{line: "http://a/b x y", err: "unexpected y"},
+		{line: "http://a/b -o", err: "-o needs a value"},
+		{line: `http://a/b --header "X-A"`, err: `invalid header X-A , should be like "Name: value"`},
+		{line: `http://a/b --header "X A: 1"`, err: `invalid header X A: 1 , should be like "Name: value"`},
+		{line: "http://a/b --md5 xyz", err: "--md5 needs a hex checksum"},
+		{line: "http://a/b -j 3", err: "unknown flag -j"},
+		{line: "-o c.zip", err: "no url"},
+	}
+	for _, tt := range tests {
+		item, err := parseQueueLine(tt.line)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got error %v want %s", tt.line, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if tt.header == nil {
+			tt.header = http.Header{}
+		}
+		if tt.hashes == nil {
+			tt.hashes = map[string]string{}
+		}
+		if item.url != tt.url || item.saveas != tt.saveas || item.line != tt.line || !reflect.DeepEqual(item.header, tt.header) || !reflect.DeepEqual(item.hashes, tt.hashes) {
+			t.Errorf("%s: got %+v", tt.line, item)
+		}
+	}
+}
+
+func TestReadQueue(t *testing.T) {
+	tests := []struct {
+		list string
+		urls []string
+		err  string
+	}{
+		{list: "# comment\n\nhttp://a/1\n  http://a/2 two  \n", urls: []string{"http://a/1", "http://a/2"}},
+		{list: "http://a/1\nhttp://a/2\n", urls: []string{"http://a/1", "http://a/2"}},
+		{list: "http://a/1 x\nhttp://a/2\nhttp://a/3 -o x\n", err: "line 3: x is also saved by line 1"},
+		{list: "http://a/1\nftp\n", err: "line 2: invalid url ftp"},
+		{list: "# nothing\n\n", err: "no url found"},
+	}
+	for _, tt := range tests {
+		items, err := readQueue(strings.NewReader(tt.list))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: got error %v want %s", tt.list, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.list, err)
+			continue
+		}
+		var urls []string
+		for _, item := range items {
+			urls = append(urls, item.url)
+		}
+		if !reflect.DeepEqual(urls, tt.urls) {
+			t.Errorf("%q: got %v want %v", tt.list, urls, tt.urls)
+		}
+	}
+}
+
+func TestFailedPath(t *testing.T) {
+	for input, want := range map[string]string{
+		"-":                  "wget.failed",
+		"list.txt":           "list.txt.failed",
+		"list.txt.failed":    "list.txt.failed",
+		"/a/b/urls":          "/a/b/urls.failed",
+		"/a/b/urls.failed.x": "/a/b/urls.failed.x.failed",
+	} {
+		if got := failedPath(input); got != want {
+			t.Errorf("failedPath(%q) = %q want %q", input, got, want)
+		}
+	}
+}
+
+func TestPrintQueue(t *testing.T) {
+	capture(t, util.Log)
+	file := filepath.Join(t.TempDir(), "list.txt.failed")
+	items := []queueItem{
+		{line: "http://a/1", saveas: "1", ok: true},
+		{line: "http://a/2 --ua x", saveas: "2"},
+		{line: "http://a/3", saveas: "3", skip: true},
+	}
+	if printQueue(items, file) {
+		t.Fatal("a failed queue is reported ok")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil || string(data) != "http://a/2 --ua x\n" {
+		t.Fatalf("failed lines %q %v", data, err)
+	}
+	// 重试成功后失败记录被删除
+	items[1].ok = true
+	if !printQueue(items, file) {
+		t.Fatal("a finished queue is reported failed")
+	}
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("failed list not removed: %v", err)
+	}
+}
@@ -0,0 +1,633 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/suconghou/netdisk/config"
+	"github.com/suconghou/netdisk/layers/fslayer"
+	"github.com/suconghou/netdisk/util"
+)
+
+// flag types, a bool flag takes no value
+const (
+	typeBool   = "bool"
+	typeString = "string"
+	typeInt    = "int"
+	typeSize   = "size" // like 512K 2G
+	typeFile   = "file" // local file
+	typeDir    = "dir"  // local dir
+	typePath   = "path" // remote path
+)
+
+// what the positional args are, used by completion
+const (
+	argNone = iota
+	argRemote
+	argLocal
+)
+
+// Flag is a typed option of a command
+type Flag struct {
+	Name  string // as typed, like -o or --no-clobber
+	Type  string
+	Usage string
+}
+
+// Command is a subcommand of disk
+type Command struct {
+	Name     string
+	Aliases  []string
+	Args     string // synopsis of the positional args
+	Short    string
+	Flags    []Flag
+	Subs     []string // the first positional arg is one of them
+	Arg      int
+	Hidden   bool // not listed in help, shell and completion
+	NoShell  bool // not offered by the completion of the interactive shell
+	Local    bool // does not use the backend, an encrypted token is not decrypted
+	Complete func(args []string, word string) []string
+	Run      func()
+	Status   func() int // used instead of Run by the commands which have an exit status
+}
+
+var (
+	registry []*Command
+	current  *Command
+)
+
+// the flags of the load options used by get wget and play
+var loadFlags = []Flag{
+	{"--fast", typeBool, "16 threads"},
+	{"--slow", typeBool, "4 threads"},
+	{"--fat", typeBool, "8MB chunks"},
+	{"--thin", typeBool, "256KB chunks"},
+	{"--header", typeString, "extra header like \"Name: value\", can be repeated"},
+	{"--cookie", typeString, "Cookie header"},
+	{"--refer", typeString, "Referer header"},
+	{"--ua", typeString, "User-Agent header"},
+	{"--md5", typeString, "expected md5 of the file"},
+	{"--sha256", typeString, "expected sha256 of the file"},
+	{"--limit-rate", typeString, "speed limit like 2M or \"08:00,512K 19:00,off\""},
+}
+
+// outputFlags are accepted by the commands which print structured records
+var outputFlags = []Flag{
+	{"--json", typeBool, "print json records"},
+	{"--format", typeString, "text json or tsv"},
+}
+
+// globalFlags are accepted by every command
+var globalFlags = []Flag{
+	{"--no-cache", typeBool, "do not use the ls and meta cache"},
+	{"--profile", typeString, "use the config profile"},
+	{"--proxy", typeString, "http proxy like 127.0.0.1:8080"},
+	{"--socks", typeString, "socks5 proxy like 127.0.0.1:1080"},
+	{"--no-check-certificate", typeBool, "skip tls verification"},
+}
+
+// filterHelp are the flags of filterFlags
+var filterHelp = []Flag{
+	{"-name", typeString, "name glob like *.mp4"},
+	{"-regex", typeString, "name regexp"},
+	{"-min-size", typeSize, "min size like 2G"},
+	{"-max-size", typeSize, "max size like 100M"},
+	{"-newer", typeString, "modified after date or age like 2020-01-01 30d"},
+	{"-older", typeString, "modified before date or age like 2020-01-01 1y"},
+	{"-type", typeString, "f for file, d for dir"},
+	{"-ext", typeString, "extensions like mp4,mkv"},
+	{"-md5", typeString, "content md5"},
+	{"-print0", typeBool, "print paths separated by NUL"},
+}
+
+func init() {
+	hash := func(t string) func() {
+		return func() { Hash(t) }
+	}
+	register(
+		&Command{Name: "ls", Args: "[path]", Short: "list files of the dir", Arg: argRemote, Flags: outputFlags, Run: Ls},
+		&Command{Name: "cd", Args: "path", Short: "enter the dir and list files", Arg: argRemote, Flags: outputFlags, Run: Cd},
+		&Command{Name: "pwd", Short: "print the current dir", Run: Pwd},
+		&Command{Name: "info", Args: "[path]", Short: "print the disk usage or the file info", Arg: argRemote, Flags: append([]Flag{
+			{"--link", typeBool, "print the download link, it carries the token"},
+		}, outputFlags...), Run: Info},
+		&Command{Name: "mv", Args: "path newpath", Short: "move a file or dir", Arg: argRemote, Run: Mv},
+		&Command{Name: "cp", Args: "path newpath", Short: "copy a file or dir", Arg: argRemote, Run: Cp},
+		&Command{Name: "mkdir", Args: "path", Short: "create a dir", Arg: argRemote, Run: Mkdir},
+		&Command{Name: "rm", Args: "path", Short: "delete a file or dir", Arg: argRemote, Run: Rm},
+		&Command{Name: "get", Args: "path", Short: "download a file with several threads", Arg: argRemote, Flags: loadFlags, Run: Get},
+		&Command{Name: "put", Args: "file|- [-f savepath]", Short: "upload a file, rapid upload is tried first", Arg: argLocal, Flags: []Flag{
+			{"-f", typePath, "overwrite, optionally save as the path"},
+			{"--limit-rate", typeString, "speed limit like 1M"},
+		}, Run: Put},
+		&Command{Name: "wget", Local: true, Args: "url [url2 ...] | file.meta4 | -i list | -r url", Short: "download urls like wget", Flags: append([]Flag{
+			{"-o", typeFile, "save as"},
+			{"--mirrors", typeFile, "mirror list, each line is a url and an optional weight"},
+			{"--no-clobber", typeBool, "skip if the file exists"},
+			{"--auto-rename", typeBool, "save as name.1.ext if the file exists"},
+			{"-i", typeFile, "download the urls of the file, - is stdin"},
+			{"-j", typeInt, "files downloaded at the same time"},
+			{"-r", typeBool, "mirror the site recursively"},
+			{"-l", typeInt, "max depth of -r"},
+			{"-P", typeDir, "save dir of -r"},
+			{"--no-parent", typeBool, "do not ascend to the parent dir"},
+			{"--no-robots", typeBool, "ignore robots.txt"},
+		}, loadFlags...), Status: Wget},
+		&Command{Name: "play", Args: "path|url", Short: "play while downloading", Arg: argRemote, Flags: append([]Flag{
+			{"--stdout", typeBool, "write to stdout"},
+			{"-r", typeBool, "play the media files of a remote dir as a playlist"},
+			{"--stream", typeBool, "play the HLS transcoded by the backend"},
+			{"--type", typeString, "stream type like M3U8_AUTO_480"},
+		}, loadFlags...), Run: Play},
+		&Command{Name: "thumb", Args: "path", Short: "save the thumbnail of an image or video", Arg: argRemote, Flags: []Flag{
+			{"-s", typeString, "size WxH, at most 1600x1600"},
+			{"-o", typeFile, "save as"},
+		}, Run: Thumb},
+		&Command{Name: "cat", Aliases: []string{"head", "tail"}, Args: "path", Short: "print a remote file, head and tail print a part", Arg: argRemote, Flags: []Flag{
+			{"-c", typeSize, "bytes to print like 100 10K 2M"},
+			{"-t", typeInt, "concurrent connections"},
+		}, Run: Cat},
+		&Command{Name: "hash", Local: true, Aliases: []string{"sha1", "sha1sum"}, Args: "file [file2 ...]", Short: "print the sha1 of local files", Arg: argLocal, Run: hash("sha1")},
+		&Command{Name: "sha256", Local: true, Args: "file [file2 ...]", Short: "print the sha256 of local files", Arg: argLocal, Run: hash("sha256")},
+		&Command{Name: "md5", Local: true, Aliases: []string{"md5sum"}, Args: "file [file2 ...]", Short: "print the md5 of local files", Arg: argLocal, Run: hash("md5")},
+		&Command{Name: "crc32", Local: true, Args: "file [file2 ...]", Short: "print the crc32 of local files", Arg: argLocal, Run: hash("crc32")},
+		&Command{Name: "search", Args: "name", Short: "search files on the backend", Flags: outputFlags, Run: Search},
+		&Command{Name: "du", Args: "[path]", Short: "print the size of sub dirs", Arg: argRemote, Flags: append([]Flag{
+			{"-d", typeInt, "depth"},
+			{"-j", typeInt, "concurrent workers"},
+		}, outputFlags...), Run: Du},
+		&Command{Name: "tree", Args: "[path]", Short: "print the hierarchy of the dir", Arg: argRemote, Flags: append([]Flag{
+			{"-L", typeInt, "depth"},
+			{"-j", typeInt, "concurrent workers"},
+		}, outputFlags...), Run: Tree},
+		&Command{Name: "find", Args: "[path]", Short: "walk the dir and filter files", Arg: argRemote, Flags: append(append(append([]Flag{}, filterHelp...),
+			Flag{"-j", typeInt, "concurrent workers"},
+			Flag{"-delete", typeBool, "delete matched files"},
+		), outputFlags...), Run: Find},
+		&Command{Name: "dedupe", Args: "[path]", Short: "find duplicate files by size and md5", Arg: argRemote, Flags: append([]Flag{
+			{"-keep", typeString, "which copy to keep: oldest newest shortest"},
+			{"-move", typePath, "move duplicates to this dir"},
+			{"-delete", typeBool, "delete duplicates"},
+			{"-dry-run", typeBool, "only print what would be done"},
+			{"-j", typeInt, "concurrent workers"},
+		}, outputFlags...), Run: Dedupe},
+		&Command{Name: "verify", Args: "local remote", Short: "compare a local file or dir with the remote", Arg: argLocal, Flags: append([]Flag{
+			{"-j", typeInt, "concurrent workers"},
+		}, outputFlags...), Status: Verify},
+		&Command{Name: "changes", Short: "print the changes since the last run", Flags: append([]Flag{
+			{"-since", typeString, "cursor, default is the stored one"},
+			{"-init", typeBool, "only store the current cursor"},
+		}, outputFlags...), Run: Changes},
+		&Command{Name: "index", Args: "build | query [path]", Short: "build or query the local index of the remote tree", Subs: []string{"build", "query"}, Arg: argRemote, Flags: append(append([]Flag{
+			{"-full", typeBool, "rebuild the whole index"},
+		}, filterHelp...), outputFlags...), Run: Index},
+		&Command{Name: "task", Args: "list | add savepath url | info id | remove id", Short: "manage the cloud download tasks", Subs: []string{"list", "add", "info", "remove"}, Flags: outputFlags, Run: Task},
+		&Command{Name: "empty", Short: "empty the recycle bin", Run: Empty},
+		&Command{Name: "config", Local: true, Args: "[list | path | get key | set key value | encrypt | decrypt]", Short: "print or change the config file", Subs: []string{"list", "path", "get", "set", "encrypt", "decrypt"}, Complete: completeConfig, Run: Config},
+		&Command{Name: "shell", Local: true, Short: "start an interactive shell", NoShell: true, Run: func() { Shell(Dispatch) }},
+		&Command{Name: "serve", Local: true, Short: "start a http file server", NoShell: true, Flags: []Flag{
+			{"-p", typeInt, "listen port"},
+			{"-d", typeDir, "document root"},
+			{"-l", typeBool, "print address"},
+		}, Run: Serve},
+		&Command{Name: "proxy", Local: true, Short: "start a http and socks proxy", NoShell: true, Flags: []Flag{
+			{"-p", typeInt, "listen port"},
+			{"-socks", typeString, "upstream socks proxy"},
+			{"-limit-rate", typeString, "speed limit of all connections"},
+		}, Run: Proxy},
+		&Command{Name: "reverse", Local: true, Short: "start a reverse http proxy", NoShell: true, Flags: []Flag{
+			{"-p", typeInt, "listen port"},
+			{"-u", typeString, "upstream url"},
+			{"-proxy", typeString, "upstream http proxy"},
+			{"-socks", typeString, "upstream socks proxy"},
+			{"-header", typeString, "extra headers"},
+			{"-limit-rate", typeString, "speed limit of all connections"},
+		}, Run: HTTPProxy},
+		&Command{Name: "nc", Local: true, Args: "host port | -l port", Short: "netcat", NoShell: true, Flags: []Flag{
+			{"-l", typeInt, "listen on the port"},
+			{"-v", typeBool, "show the progress"},
+		}, Run: Nc},
+		&Command{Name: "fwd", Local: true, Args: "listen target", Short: "forward a port", NoShell: true, Flags: []Flag{
+			{"-u", typeBool, "forward udp"},
+			{"--limit-rate", typeString, "speed limit of all connections"},
+		}, Run: Fwd},
+		&Command{Name: "network", Local: true, Short: "test the http speed", NoShell: true, Flags: []Flag{
+			{"-s", typeInt, "chunk size"},
+			{"-t", typeInt, "timeout"},
+			{"-i", typeFile, "input file"},
+			{"-proxy", typeString, "http proxy"},
+			{"-socks", typeString, "socks proxy"},
+			{"-host", typeString, "http host"},
+			{"-path", typeString, "http path"},
+			{"-https", typeBool, "use https"},
+		}, Run: Network},
+		&Command{Name: "completion", Local: true, Args: "bash|zsh|fish", Short: "print the shell completion script", Subs: []string{"bash", "zsh", "fish"}, NoShell: true, Status: Completion},
+		&Command{Name: "help", Local: true, Args: "[command]", Short: "print the commands or the help of one", Complete: completeCommand, Run: Help},
+		&Command{Name: "__complete", Local: true, Hidden: true, Run: completeWords},
+	)
+}
+
+func register(cmds ...*Command) {
+	registry = append(registry, cmds...)
+}
+
+// Lookup return the command of name or alias
+func Lookup(name string) *Command {
+	for _, c := range registry {
+		if c.Name == name {
+			return c
+		}
+		for _, a := range c.Aliases {
+			if a == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// Dispatch run the command of os.Args and return the exit status, -h or --help print its help
+func Dispatch() int {
+	// 补全时保留正在输入的全局参数
+	if len(os.Args) > 1 {
+		if c := Lookup(os.Args[1]); c != nil && c.Hidden {
+			current = c
+			c.Run()
+			return 0
+		}
+	}
+	fslayer.SetCache(!util.PickFlag("--no-cache"))
+	if len(os.Args) < 2 {
+		Usage()
+		return 0
+	}
+	c := Lookup(os.Args[1])
+	if c == nil {
+		Usage()
+		return 2
+	}
+	current = c
+	// 只有输出结构化记录的命令才取走 --json 和 --format, 其他命令里它们可能是参数
+	var format string
+	if f, _, _ := c.flag("--format"); f != nil {
+		format = util.ParseFormat()
+	}
+	if err := fslayer.SetFormat(format); err != nil {
+		util.Log.Print(err)
+		return 2
+	}
+	if !c.Hidden {
+		for _, arg := range os.Args[2:] {
+			if arg == "-h" || arg == "--help" {
+				c.help(os.Args[1])
+				return 0
+			}
+		}
+		if err := c.check(os.Args[2:]); err != nil {
+			util.Log.Print(err)
+			return 2
+		}
+	}
+	if !c.Local {
+		if err := fslayer.Unlock(); err != nil {
+			util.Log.Print(err)
+			return 1
+		}
+	}
+	if c.Status != nil {
+		return c.Status()
+	}
+	c.Run()
+	return 0
+}
+
+// flag return the declared or global flag of arg, arg may be like -j=4
+func (c *Command) flag(arg string) (*Flag, string, bool) {
+	name, value, inline := arg, "", false
+	if i := strings.Index(arg, "="); i > 0 {
+		name, value, inline = arg[:i], arg[i+1:], true
+	}
+	for _, flags := range [][]Flag{c.Flags, globalFlags} {
+		for i := range flags {
+			if sameFlag(flags[i].Name, name) {
+				return &flags[i], value, inline
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// sameFlag report whether arg is the declared flag, go flag also accept --name for -name
+func sameFlag(declared string, arg string) bool {
+	return declared == arg || !strings.HasPrefix(declared, "--") && "-"+declared == arg
+}
+
+// takesValue report whether arg is a flag followed by its value
+func (c *Command) takesValue(arg string) bool {
+	f, _, inline := c.flag(arg)
+	return f != nil && f.Type != typeBool && !inline
+}
+
+// check reject undeclared flags and validate the values of typed flags, args after -- are not flags
+func (c *Command) check(args []string) error {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			break
+		}
+		f, value, inline := c.flag(args[i])
+		if f == nil {
+			if strings.HasPrefix(args[i], "-") && args[i] != "-" {
+				return fmt.Errorf("unknown flag %s , see disk %s -h", args[i], c.Name)
+			}
+			continue
+		}
+		if f.Type == typeBool {
+			continue
+		}
+		if !inline {
+			if i+1 >= len(args) {
+				// -f of put is optional
+				if f.Type == typePath {
+					continue
+				}
+				return fmt.Errorf("%s needs a %s value", f.Name, f.Type)
+			}
+			i++
+			value = args[i]
+		}
+		switch f.Type {
+		case typeInt:
+			if _, err := strconv.Atoi(value); err != nil {
+				return fmt.Errorf("invalid value %s for %s , should be an integer", value, f.Name)
+			}
+		case typeSize:
+			if _, err := util.ParseSize(value); err != nil {
+				return fmt.Errorf("invalid value %s for %s , should be a size like 512K 2G", value, f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// help print the usage flags and global flags of the command
+func (c *Command) help(name string) {
+	b := strings.Builder{}
+	b.WriteString(fmt.Sprintf("Usage:disk %s", name))
+	if len(c.Flags) > 0 {
+		b.WriteString(" [flags]")
+	}
+	if c.Args != "" {
+		b.WriteString(" " + c.Args)
+	}
+	b.WriteString("\n" + c.Short)
+	if len(c.Aliases) > 0 {
+		b.WriteString("\n\naliases: " + strings.Join(append([]string{c.Name}, c.Aliases...), " "))
+	}
+	if len(c.Flags) > 0 {
+		b.WriteString("\n\nflags:")
+		writeFlags(&b, c.Flags)
+	}
+	b.WriteString("\n\nglobal flags:")
+	writeFlags(&b, globalFlags)
+	util.Log.Print(b.String())
+}
+
+func writeFlags(b *strings.Builder, flags []Flag) {
+	for _, f := range flags {
+		name := f.Name
+		if f.Type != typeBool {
+			name += " " + f.Type
+		}
+		b.WriteString(fmt.Sprintf("\n  %-24s%s", name, f.Usage))
+	}
+}
+
+// Help print the commands, or the help of the command
+func Help() {
+	if len(os.Args) > 2 {
+		c := Lookup(os.Args[2])
+		if c == nil || c.Hidden {
+			util.Log.Printf("unknown command %s", os.Args[2])
+			return
+		}
+		c.help(os.Args[2])
+		return
+	}
+	printCommands()
+}
+
+// printCommands print the commands and their short help
+func printCommands() {
+	b := strings.Builder{}
+	b.WriteString("Usage:disk command [flags] [args]\n\ncommands:")
+	for _, c := range registry {
+		if c.Hidden {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("\n  %-12s%s", c.Name, c.Short))
+		if len(c.Aliases) > 0 {
+			b.WriteString(" (" + strings.Join(c.Aliases, " ") + ")")
+		}
+	}
+	b.WriteString("\n\nrun disk command -h for the flags of a command")
+	util.Log.Print(b.String())
+}
+
+// shellNames return the commands and aliases which can run in the shell
+func shellNames() []string {
+	var names []string
+	for _, c := range registry {
+		if !c.Hidden && !c.NoShell {
+			names = append(names, c.Name)
+			names = append(names, c.Aliases...)
+		}
+	}
+	return append(names, "exit")
+}
+
+// candidates return the completions of word, args are the words before it
+// finished words end with a space and dirs with /
+func (cp *completer) candidates(args []string, word string) []string {
+	if len(args) == 0 {
+		return completeCommand(nil, word)
+	}
+	c := Lookup(args[0])
+	if c == nil {
+		return cp.remote(word)
+	}
+	if strings.HasPrefix(word, "-") {
+		var names []string
+		for _, flags := range [][]Flag{c.Flags, globalFlags} {
+			for _, f := range flags {
+				if strings.HasPrefix(word, "--") && !strings.HasPrefix(f.Name, "--") && len(f.Name) > 2 {
+					names = append(names, "-"+f.Name)
+				} else {
+					names = append(names, f.Name)
+				}
+			}
+		}
+		return matchWords(names, word)
+	}
+	var positional []string
+	for i := 1; i < len(args); i++ {
+		if c.takesValue(args[i]) {
+			if i == len(args)-1 {
+				f, _, _ := c.flag(args[i])
+				switch f.Type {
+				case typeFile, typeDir:
+					return cp.local(word)
+				case typePath:
+					return cp.remote(word)
+				}
+				return nil
+			}
+			i++
+		} else if !strings.HasPrefix(args[i], "-") || args[i] == "-" {
+			positional = append(positional, args[i])
+		}
+	}
+	if c.Complete != nil {
+		return c.Complete(positional, word)
+	}
+	if len(c.Subs) > 0 && len(positional) == 0 {
+		return matchWords(c.Subs, word)
+	}
+	switch c.Arg {
+	case argLocal:
+		return cp.local(word)
+	case argRemote:
+		return cp.remote(word)
+	}
+	return nil
+}
+
+// completeCommand complete the command names
+func completeCommand(args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	var names []string
+	for _, c := range registry {
+		if !c.Hidden {
+			names = append(names, c.Name)
+			names = append(names, c.Aliases...)
+		}
+	}
+	sort.Strings(names)
+	return matchWords(names, word)
+}
+
+// completeConfig complete the sub commands and the keys of get and set
+func completeConfig(args []string, word string) []string {
+	cmd := Lookup("config")
+	switch {
+	case len(args) == 0:
+		return matchWords(cmd.Subs, word)
+	case len(args) == 1 && (args[0] == "get" || args[0] == "set"):
+		var keys []string
+		for _, k := range config.Keys() {
+			keys = append(keys, strings.ToLower(strings.TrimPrefix(config.EnvName(k), "DISK_")))
+		}
+		return matchWords(keys, word)
+	}
+	return nil
+}
+
+func matchWords(words []string, prefix string) []string {
+	var matched []string
+	seen := map[string]bool{}
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) && !seen[w] {
+			seen[w] = true
+			matched = append(matched, w+" ")
+		}
+	}
+	return matched
+}
+
+// completeWords print the completions of os.Args[2:], the last one is the word being completed
+func completeWords() {
+	// 补全脚本把 stdout 的每行当作候选, 错误只能写到 stderr
+	util.Log.SetOutput(util.Redact(os.Stderr))
+	args := os.Args[2:]
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for i := range args {
+		args[i] = strings.ReplaceAll(args[i], "\\ ", " ")
+	}
+	cp := &completer{dirs: map[string][]string{}}
+	var lines []string
+	for _, c := range cp.candidates(args[:len(args)-1], args[len(args)-1]) {
+		lines = append(lines, strings.TrimSuffix(c, " "))
+	}
+	if len(lines) > 0 {
+		util.Raw.Print(strings.Join(lines, "\n"))
+	}
+}
+
+// Completion print the completion script of bash zsh or fish, errors go to stderr as the script is usually sourced
+func Completion() int {
+	var (
+		name   = filepath.Base(os.Args[0])
+		fn     = "_" + strings.NewReplacer("-", "_", ".", "_").Replace(name)
+		script string
+	)
+	if len(os.Args) != 3 {
+		util.Warn.Print("Usage:disk completion bash|zsh|fish")
+		return 2
+	}
+	switch os.Args[2] {
+	case "bash":
+		script = fmt.Sprintf(bashCompletion, fn, name)
+	case "zsh":
+		script = fmt.Sprintf(zshCompletion, fn, name)
+	case "fish":
+		script = fmt.Sprintf(fishCompletion, fn, name)
+	default:
+		util.Warn.Printf("unknown shell %s , should be bash zsh or fish", os.Args[2])
+		return 2
+	}
+	util.Raw.Print(script)
+	return 0
+}
+
+// source <(disk completion bash)
+const bashCompletion = `%[1]s() {
+	local cur=${COMP_WORDS[COMP_CWORD]} line
+	COMPREPLY=()
+	while IFS= read -r line; do
+		[[ -n $line ]] && COMPREPLY+=("$(printf '%%q' "$line")")
+	done < <(%[2]s __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null)
+	if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+		compopt -o nospace
+	fi
+}
+complete -F %[1]s %[2]s`
+
+// disk completion zsh > "${fpath[1]}/_disk"
+const zshCompletion = `#compdef %[2]s
+%[1]s() {
+	local -a lines dirs words_
+	local line
+	lines=("${(@f)$(%[2]s __complete "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)}")
+	for line in $lines; do
+		[[ -z $line ]] && continue
+		if [[ $line == */ ]]; then dirs+=$line; else words_+=$line; fi
+	done
+	(( ${#dirs} )) && compadd -S '' -- $dirs
+	(( ${#words_} )) && compadd -- $words_
+	return 0
+}
+compdef %[1]s %[2]s`
+
+// disk completion fish > ~/.config/fish/completions/disk.fish
+const fishCompletion = `function %[1]s
+	set -l tokens (commandline -opc)
+	%[2]s __complete $tokens[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c %[2]s -f -a '(%[1]s)'`
@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/suconghou/netdisk/layers/fslayer"
+	"github.com/suconghou/netdisk/util"
+)
+
+// capture collect what the loggers print until the test ends
+func capture(t *testing.T, loggers ...*log.Logger) *bytes.Buffer {
+	var b bytes.Buffer
+	for _, l := range loggers {
+		prev := l.Writer()
+		l.SetOutput(&b)
+		t.Cleanup(func() { l.SetOutput(prev) })
+	}
+	return &b
+}
+
+// dispatch run Dispatch with args and return the exit status and the output
+func dispatch(t *testing.T, args ...string) (int, string) {
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	os.Args = append([]string{"disk"}, args...)
+	out := capture(t, util.Log, util.Warn, util.Raw)
+	return Dispatch(), out.String()
+}
+
+func TestDispatchHelp(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"ls", "-h"}, []string{"Usage:disk ls [flags] [path]", "--json", "global flags:", "--no-cache"}},
+		{[]string{"head", "--help"}, []string{"Usage:disk head [flags] path", "aliases: cat head tail", "-c size"}},
+		{[]string{"du", "-d", "2", "-h"}, []string{"-d int", "-j int"}},
+		{[]string{"wget", "-h"}, []string{"-o file", "--no-clobber", "--limit-rate string"}},
+		{[]string{"proxy", "-h"}, []string{"-limit-rate string"}},
+	}
+	for _, tt := range tests {
+		code, out := dispatch(t, tt.args...)
+		if code != 0 {
+			t.Errorf("%v: exit %d", tt.args, code)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(out, w) {
+				t.Errorf("%v: help has no %q:\n%s", tt.args, w, out)
+			}
+		}
+	}
+}
+
+func TestDispatchCheck(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ls", "--bogus"}, "unknown flag --bogus , see disk ls -h"},
+		{[]string{"wget", "-x", "http://a/b"}, "unknown flag -x , see disk wget -h"},
+		{[]string{"md5", "file", "--json"}, "unknown flag --json , see disk md5 -h"},
+		{[]string{"du", "-d", "x"}, "invalid value x for -d , should be an integer"},
+		{[]string{"du", "-j=two"}, "invalid value two for -j , should be an integer"},
+		{[]string{"cat", "-c", "1Q", "file"}, "invalid value 1Q for -c , should be a size like 512K 2G"},
+		{[]string{"get", "file", "--header"}, "--header needs a string value"},
+		{[]string{"ls", "--format", "xml"}, "unknown format xml , should be text json or tsv"},
+	}
+	for _, tt := range tests {
+		code, out := dispatch(t, tt.args...)
+		if code != 2 {
+			t.Errorf("%v: exit %d want 2", tt.args, code)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("%v: got %q want %q", tt.args, out, tt.want)
+		}
+	}
+}
+
+func TestCheckAccepts(t *testing.T) {
+	tests := [][]string{
+		{"du", "-d", "2", "-j=4", "/"},
+		{"put", "file", "-f"},
+		{"put", "-", "-f", "/a.txt", "--limit-rate", "1M"},
+		{"proxy", "--limit-rate", "1M", "-p", "8080"},
+		{"wget", "-r", "-l", "3", "--no-parent", "http://a/", "--no-check-certificate"},
+		{"wget", "--", "-odd-name"},
+		{"put", "-"},
+	}
+	for _, args := range tests {
+		if err := Lookup(args[0]).check(args[1:]); err != nil {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+}
+
+func TestPositionalArgs(t *testing.T) {
+	saved := current
+	defer func() { current = saved }()
+	current = Lookup("play")
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--fast", "/a.mp4"}, []string{"/a.mp4"}},
+		{[]string{"--header", "X: y", "http://a/b.mp4"}, []string{"http://a/b.mp4"}},
+		{[]string{"--type=M3U8_AUTO_480", "/a.mp4", "--stdout"}, []string{"/a.mp4"}},
+		{[]string{"--fast", "--", "-a.mp4"}, []string{"-a.mp4"}},
+	}
+	for _, tt := range tests {
+		if got := positionalArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	cp := &completer{dirs: map[string][]string{
+		fslayer.AbsPath(""): {"a.mp4", "docs/"},
+	}}
+	tests := []struct {
+		args []string
+		word string
+		want []string
+	}{
+		{nil, "tai", []string{"tail"}},
+		{nil, "__", nil},
+		{[]string{"ls"}, "--j", []string{"--json"}},
+		{[]string{"md5"}, "--j", nil},
+		{[]string{"proxy"}, "--lim", []string{"--limit-rate"}},
+		{[]string{"proxy"}, "-lim", []string{"-limit-rate"}},
+		{[]string{"completion"}, "", []string{"bash", "zsh", "fish"}},
+		{[]string{"index"}, "b", []string{"build"}},
+		{[]string{"config"}, "enc", []string{"encrypt"}},
+		{[]string{"du", "-j"}, "", nil},
+		{[]string{"ls"}, "d", []string{"docs/"}},
+		{[]string{"get", "--fast"}, "a", []string{"a.mp4"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range cp.candidates(tt.args, tt.word) {
+			got = append(got, strings.TrimSuffix(c, " "))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v %q: got %v want %v", tt.args, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		shell string
+		code  int
+		want  []string
+	}{
+		{"bash", 0, []string{"_disk() {", "disk __complete", "complete -F _disk disk"}},
+		{"zsh", 0, []string{"#compdef disk", "disk __complete", "compdef _disk disk"}},
+		{"fish", 0, []string{"disk __complete", "complete -c disk"}},
+		{"csh", 2, []string{"unknown shell csh"}},
+	}
+	for _, tt := range tests {
+		saved := os.Args
+		os.Args = []string{"/usr/local/bin/disk", "completion", tt.shell}
+		out := capture(t, util.Raw, util.Warn)
+		code := Completion()
+		os.Args = saved
+		if code != tt.code {
+			t.Errorf("%s: exit %d want %d", tt.shell, code, tt.code)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(out.String(), w) {
+				t.Errorf("%s: output has no %q:\n%s", tt.shell, w, out)
+			}
+		}
+	}
+}
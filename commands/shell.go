@@ -0,0 +1,256 @@
+package commands
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/suconghou/netdisk/config"
+	"github.com/suconghou/netdisk/layers/fslayer"
+	"github.com/suconghou/netdisk/util"
+	"golang.org/x/term"
+)
+
+const historySize = 100
+
+var (
+	// commands which change remote dirs
+	mutateCommands = map[string]bool{"cd": true, "cp": true, "mv": true, "mkdir": true, "rm": true, "put": true, "empty": true, "find": true, "dedupe": true}
+)
+
+type completer struct {
+	dirs map[string][]string
+}
+
+// Shell start a interactive shell, each line is run by dispatch and its exit status is ignored
+func Shell(dispatch func() int) {
+	var (
+		fd   = int(os.Stdin.Fd())
+		argv = os.Args[0]
+		cwd  = config.Cfg.Path
+	)
+	fslayer.SetAutoSave(false)
+	defer func() {
+		if config.Cfg.Path != cwd {
+			if err := config.Cfg.Save(); err != nil {
+				util.Log.Print(err)
+			}
+		}
+	}()
+	run := func(line string) bool {
+		args := util.SplitArgs(line)
+		if len(args) == 0 {
+			return true
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return false
+		case "shell":
+			return true
+		}
+		os.Args = append([]string{argv}, args...)
+		dispatch()
+		return true
+	}
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() && run(scanner.Text()) {
+		}
+		return
+	}
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, shellPrompt())
+	c := &completer{dirs: map[string][]string{}}
+	t.AutoCompleteCallback = c.complete
+	history := loadHistory(t)
+	if history != nil {
+		defer history.Close()
+	}
+	for {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			util.Log.Print(err)
+			return
+		}
+		line, err := t.ReadLine()
+		term.Restore(fd, state)
+		if err != nil {
+			if err != io.EOF {
+				util.Log.Print(err)
+			}
+			return
+		}
+		if history != nil && strings.TrimSpace(line) != "" {
+			history.WriteString(line + "\n")
+		}
+		if !run(line) {
+			return
+		}
+		if args := util.SplitArgs(line); len(args) > 0 && mutateCommands[args[0]] {
+			c.dirs = map[string][]string{}
+		}
+		t.SetPrompt(shellPrompt())
+	}
+}
+
+func shellPrompt() string {
+	return "disk " + fslayer.AbsPath("") + " ➜ "
+}
+
+// loadHistory fill the terminal history and return the file to append, the file is cut to the last historySize lines
+func loadHistory(t *term.Terminal) *os.File {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(home, ".disk_history"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) > historySize {
+		lines = lines[len(lines)-historySize:]
+		// 只追加会让文件无限增长, 超出时重写为最后 historySize 行
+		if err = file.Truncate(0); err == nil {
+			_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+		}
+		if err != nil {
+			util.Warn.Print(err)
+		}
+	}
+	for _, line := range lines {
+		t.History.Add(line)
+	}
+	return file
+}
+
+// complete is the terminal AutoCompleteCallback
+func (c *completer) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	var (
+		prefix     = line[:pos]
+		start      = wordStart(prefix)
+		word       = strings.ReplaceAll(prefix[start:], "\\ ", " ")
+		args       = util.SplitArgs(prefix[:start])
+		candidates []string
+	)
+	if len(args) == 0 {
+		candidates = matchWords(shellNames(), word)
+	} else {
+		candidates = c.candidates(args, word)
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	done := commonPrefix(candidates)
+	if len(done) <= len(word) {
+		return "", 0, false
+	}
+	done = strings.ReplaceAll(done, " ", "\\ ")
+	if strings.HasSuffix(done, "\\ ") && len(candidates) == 1 {
+		done = strings.TrimSuffix(done, "\\ ") + " "
+	}
+	return prefix[:start] + done + line[pos:], start + len(done), true
+}
+
+// remote return remote paths with prefix word, dirs end with /, nothing while the token is encrypted
+func (c *completer) remote(word string) []string {
+	var (
+		i          = strings.LastIndex(word, "/")
+		dir, base  = word[:i+1], word[i+1:]
+		candidates []string
+	)
+	// 补全时不询问口令, 未解密时不补全远程路径
+	if config.Locked() {
+		return nil
+	}
+	abs := fslayer.AbsPath(dir)
+	names, ok := c.dirs[abs]
+	if !ok {
+		items, err := fslayer.List(abs)
+		if err != nil {
+			return nil
+		}
+		for _, item := range items {
+			name := path.Base(item.Path)
+			if item.IsDir {
+				name += "/"
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.dirs[abs] = names
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, base) {
+			candidates = append(candidates, completeName(dir, name))
+		}
+	}
+	return candidates
+}
+
+// local return local paths with prefix word, dirs end with /
+func (c *completer) local(word string) []string {
+	var (
+		i          = strings.LastIndex(word, "/")
+		dir, base  = word[:i+1], word[i+1:]
+		candidates []string
+	)
+	d := dir
+	if d == "" {
+		d = "."
+	}
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, base) {
+			if entry.IsDir() {
+				name += "/"
+			}
+			candidates = append(candidates, completeName(dir, name))
+		}
+	}
+	return candidates
+}
+
+func completeName(dir string, name string) string {
+	if strings.HasSuffix(name, "/") {
+		return dir + name
+	}
+	return dir + name + " "
+}
+
+func commonPrefix(items []string) string {
+	prefix := []rune(items[0])
+	for _, item := range items[1:] {
+		for !strings.HasPrefix(item, string(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return string(prefix)
+}
+
+// wordStart return the start index of the last word, spaces escaped by \ are kept
+func wordStart(s string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == ' ' && (i == 0 || s[i-1] != '\\') {
+			return i + 1
+		}
+	}
+	return 0
+}
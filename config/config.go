@@ -1,12 +1,26 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 )
 
-var configPath = "/etc/disk.json"
+// legacyPath is used if it exists and no user config is found
+var legacyPath = "/etc/disk.json"
+
+var (
+	configPath string
+	savePath   string // where Save writes, the legacy file is read only
+	profile    string
+	loadErr    error
+	fileCfg    appcfg // the values in the file, env overrides are not saved
+)
 
 // Version and ReleaseURL
 const (
@@ -16,9 +30,15 @@ const (
 
 // Appcfg config
 type appcfg struct {
-	Token string
-	Root  string
-	Path  string
+	Token       string `secret:"true"`
+	Root        string
+	Path        string
+	LimitRate   string  // default of --limit-rate, like 2M or "08:00,512K 19:00,off"
+	Player      string  // player command like "mpv --fs {url}", {file} is the local file
+	PlayerStart float64 // percent downloaded before the player starts, default 2
+	Cursor      string  // cursor of the last changes
+	CursorTime  int64   // time of the last changes, entries created after it are new
+	CacheTTL    int     // seconds the ls and meta responses are cached, default 30, negative disables
 }
 
 // Cfg config the whole app
@@ -26,10 +46,81 @@ var Cfg appcfg
 
 func init() {
 	if runtime.GOOS == "windows" {
-		configPath = `C:\Users\Default\disk.json`
+		legacyPath = `C:\Users\Default\disk.json`
 	}
+	profile = pickProfile()
+	configPath, savePath = findPath(profile)
 	// 即时没有配置文件,也允许运行
-	loadConfig()
+	if err := loadConfig(); err != nil && !os.IsNotExist(err) {
+		loadErr = err
+	}
+	// 密钥在用到时才解密, 见 Unlock
+	encrypted = sealed(&Cfg)
+	fileCfg = Cfg
+	applyEnv(&Cfg, true)
+}
+
+// Path return the config file in use
+func Path() string {
+	return configPath
+}
+
+// SavePath return where Save writes, it differs from Path while the legacy file is read
+func SavePath() string {
+	return savePath
+}
+
+// Profile return the profile of --profile or DISK_PROFILE, empty is the default one
+func Profile() string {
+	return profile
+}
+
+// Error return the error of reading the config file, a missing file is not an error
+func Error() error {
+	return loadErr
+}
+
+// pickProfile take --profile name out of os.Args, DISK_PROFILE is the default
+func pickProfile() string {
+	name := os.Getenv("DISK_PROFILE")
+	for i := 1; i < len(os.Args)-1; i++ {
+		if os.Args[i] == "--profile" {
+			name = os.Args[i+1]
+			os.Args = append(os.Args[:i:i], os.Args[i+2:]...)
+			break
+		}
+	}
+	return name
+}
+
+// findPath resolve the config file: DISK_CONFIG, $XDG_CONFIG_HOME/netdisk, then the legacy /etc/disk.json
+// the second path is where to save, the shared legacy file is migrated to the user path
+func findPath(profile string) (string, string) {
+	name := "disk.json"
+	if profile != "" {
+		name = "disk-" + profile + ".json"
+	}
+	if p := os.Getenv("DISK_CONFIG"); p != "" {
+		if profile != "" {
+			p = filepath.Join(filepath.Dir(p), name)
+		}
+		return p, p
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir, _ = os.UserConfigDir()
+	}
+	user := filepath.Join(dir, "netdisk", name)
+	if dir == "" {
+		user = filepath.Join(filepath.Dir(legacyPath), name)
+	}
+	if _, err := os.Stat(user); err == nil || profile != "" {
+		return user, user
+	}
+	if _, err := os.Stat(legacyPath); err == nil && user != legacyPath {
+		return legacyPath, user
+	}
+	return user, user
 }
 
 func loadConfig() error {
@@ -37,13 +128,79 @@ func loadConfig() error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal([]byte(strJSON), &Cfg)
+	if len(bytes.TrimSpace(strJSON)) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(strJSON, &Cfg); err != nil {
+		return fmt.Errorf("invalid config %s : %v", configPath, jsonError(strJSON, err))
+	}
+	return nil
 }
 
+// jsonError add the line and column of a syntax error
+func jsonError(data []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return err
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("line %d column %d : %v", line, col, err)
+}
+
+// Save write the config atomically with mode 0600, env overrides keep the values of the file
+// the secrets are encrypted if the file was encrypted or Encrypt is called
+// a config read from the legacy file is saved to the user path, which is used since
 func (Cfg *appcfg) Save() error {
-	strJSON, err := json.Marshal(Cfg)
+	if loadErr != nil {
+		return loadErr
+	}
+	c := *Cfg
+	restoreEnv(&c, &fileCfg)
+	out := c
+	if encrypted {
+		if err := seal(&out); err != nil {
+			return err
+		}
+	}
+	strJSON, err := json.MarshalIndent(&out, "", "  ")
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(configPath, strJSON, 0777)
+	dir := filepath.Dir(savePath)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+strings.TrimSuffix(filepath.Base(savePath), ".json")+"-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if err = f.Chmod(0600); err == nil {
+		if _, err = f.Write(strJSON); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, savePath); err != nil {
+		return err
+	}
+	configPath = savePath
+	fileCfg = c
+	return nil
 }
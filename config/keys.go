@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Keys return the config keys in the order of the file
+func Keys() []string {
+	t := reflect.TypeOf(appcfg{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, t.Field(i).Name)
+	}
+	return keys
+}
+
+// EnvName return the env which overrides the key, like LimitRate => DISK_LIMIT_RATE
+func EnvName(key string) string {
+	var b strings.Builder
+	b.WriteString("DISK")
+	for i, r := range key {
+		if unicode.IsUpper(r) && (i == 0 || !unicode.IsUpper(rune(key[i-1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// Get return the value of key as string
+func Get(key string) (string, error) {
+	v, err := field(&Cfg, key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+// Set parse value by the type of key, empty value resets it
+func Set(key string, value string) error {
+	v, err := field(&Cfg, key)
+	if err != nil {
+		return err
+	}
+	return setValue(v, value)
+}
+
+// Overridden report whether the key is set by env
+func Overridden(key string) bool {
+	name, err := keyName(key)
+	if err != nil {
+		return false
+	}
+	_, ok := os.LookupEnv(EnvName(name))
+	return ok
+}
+
+// keyName match key case insensitively, limit_rate and limit-rate are also accepted
+func keyName(key string) (string, error) {
+	k := strings.NewReplacer("_", "", "-", "").Replace(key)
+	for _, name := range Keys() {
+		if strings.EqualFold(name, k) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown key %s , should be one of %s", key, strings.Join(Keys(), " "))
+}
+
+func field(c *appcfg, key string) (reflect.Value, error) {
+	name, err := keyName(key)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(c).Elem().FieldByName(name), nil
+}
+
+func setValue(v reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %s", value)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %s", value)
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid bool %s", value)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// applyEnv override the keys by DISK_* env, invalid values are ignored and reported if warn
+func applyEnv(c *appcfg, warn bool) {
+	for _, key := range Keys() {
+		value, ok := os.LookupEnv(EnvName(key))
+		if !ok {
+			continue
+		}
+		v, _ := field(c, key)
+		if err := setValue(v, value); err != nil && warn {
+			fmt.Fprintf(os.Stderr, "%s : %v\n", EnvName(key), err)
+		}
+	}
+}
+
+// restoreEnv put back the file values of the keys which come from env, unless they are changed since
+func restoreEnv(c *appcfg, file *appcfg) {
+	env := *file
+	applyEnv(&env, false)
+	for _, key := range Keys() {
+		if !Overridden(key) {
+			continue
+		}
+		cur, _ := field(c, key)
+		over, _ := field(&env, key)
+		if reflect.DeepEqual(cur.Interface(), over.Interface()) {
+			orig, _ := field(file, key)
+			cur.Set(orig)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// secretPrefix mark an encrypted value: base64 of salt nonce and the AES-GCM sealed text
+const secretPrefix = "enc:v1:"
+
+const (
+	saltSize = 16
+	scryptN  = 1 << 15
+)
+
+var (
+	passphrase string
+	encrypted  bool
+	unlockMu   sync.Mutex
+)
+
+// Encrypted report whether the secrets are encrypted in the file
+func Encrypted() bool {
+	return encrypted
+}
+
+// Locked report whether some secrets of Cfg are still encrypted, Unlock decrypts them
+func Locked() bool {
+	return sealed(&Cfg)
+}
+
+// Unlock decrypt the secrets of Cfg, the passphrase is asked only if some secret is encrypted
+// commands call it once they need the token, so the others never ask
+func Unlock() error {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	return unlock(&Cfg)
+}
+
+// Encrypt make Save encrypt the secrets with pass
+func Encrypt(pass string) error {
+	if pass == "" {
+		return errors.New("empty passphrase")
+	}
+	if err := Unlock(); err != nil {
+		return err
+	}
+	passphrase = pass
+	encrypted = true
+	return nil
+}
+
+// Decrypt make Save write the secrets in plain text
+func Decrypt() error {
+	if err := Unlock(); err != nil {
+		return err
+	}
+	passphrase = ""
+	encrypted = false
+	return nil
+}
+
+// Secrets return the values which must not be printed
+func Secrets() []string {
+	var s []string
+	v := reflect.ValueOf(Cfg)
+	for _, key := range secretKeys() {
+		if str := v.FieldByName(key).String(); str != "" {
+			s = append(s, str)
+		}
+	}
+	if passphrase != "" {
+		s = append(s, passphrase)
+	}
+	return s
+}
+
+// IsSecret report whether key is stored encrypted
+func IsSecret(key string) bool {
+	name, err := keyName(key)
+	if err != nil {
+		return false
+	}
+	for _, k := range secretKeys() {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadPassphrase return DISK_PASSPHRASE or prompt on the terminal, confirm ask twice
+func ReadPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv("DISK_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("the config is encrypted, set DISK_PASSPHRASE or run in a terminal")
+	}
+	fmt.Fprint(os.Stderr, "passphrase: ")
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "again: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(p) {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return string(p), nil
+}
+
+// secretKeys return the fields tagged secret
+func secretKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(appcfg{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") == "true" {
+			keys = append(keys, t.Field(i).Name)
+		}
+	}
+	return keys
+}
+
+// sealed report whether some secrets of c are encrypted
+func sealed(c *appcfg) bool {
+	v := reflect.ValueOf(c).Elem()
+	for _, key := range secretKeys() {
+		if strings.HasPrefix(v.FieldByName(key).String(), secretPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// unlock decrypt the secrets of c, the passphrase is asked once
+func unlock(c *appcfg) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, key := range secretKeys() {
+		f := v.FieldByName(key)
+		if !strings.HasPrefix(f.String(), secretPrefix) {
+			continue
+		}
+		if passphrase == "" {
+			p, err := ReadPassphrase(false)
+			if err != nil {
+				return err
+			}
+			passphrase = p
+		}
+		plain, err := openValue(f.String(), passphrase)
+		if err != nil {
+			passphrase = ""
+			return fmt.Errorf("decrypt %s : %v", key, err)
+		}
+		f.SetString(plain)
+		encrypted = true
+	}
+	return nil
+}
+
+// seal encrypt the secrets of c, the values still encrypted are kept
+func seal(c *appcfg) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, key := range secretKeys() {
+		f := v.FieldByName(key)
+		if f.String() == "" || strings.HasPrefix(f.String(), secretPrefix) {
+			continue
+		}
+		if passphrase == "" {
+			// 未解锁时修改了密钥, 用文件中的密文验证口令
+			file := fileCfg
+			if err := unlock(&file); err != nil {
+				return err
+			}
+			if passphrase == "" {
+				return errors.New("no passphrase to encrypt " + key)
+			}
+		}
+		s, err := sealValue(f.String(), passphrase)
+		if err != nil {
+			return err
+		}
+		f.SetString(s)
+	}
+	return nil
+}
+
+func newGCM(pass string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(pass), salt, scryptN, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealValue(plain string, pass string) (string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(pass, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := append(append(salt, nonce...), gcm.Seal(nil, nonce, []byte(plain), nil)...)
+	return secretPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func openValue(s string, pass string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, secretPrefix))
+	if err != nil || len(data) < saltSize {
+		return "", errors.New("malformed value")
+	}
+	gcm, err := newGCM(pass, data[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed value")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("wrong passphrase")
+	}
+	return string(plain), nil
+}
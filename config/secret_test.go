@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTempConfig point the config to an empty file of a temp dir, the state is restored when the test ends
+func useTempConfig(t *testing.T) string {
+	var (
+		c, f       = Cfg, fileCfg
+		cp, sp, le = configPath, savePath, loadErr
+		pass, enc  = passphrase, encrypted
+		file       = filepath.Join(t.TempDir(), "disk.json")
+	)
+	t.Cleanup(func() {
+		Cfg, fileCfg = c, f
+		configPath, savePath, loadErr = cp, sp, le
+		passphrase, encrypted = pass, enc
+	})
+	t.Setenv("DISK_TOKEN", "")
+	t.Setenv("DISK_PASSPHRASE", "")
+	Cfg, fileCfg = appcfg{}, appcfg{}
+	configPath, savePath, loadErr = file, file, nil
+	passphrase, encrypted = "", false
+	return file
+}
+
+// reload read the file like a new process does
+func reload(t *testing.T) {
+	Cfg = appcfg{}
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	passphrase = ""
+	encrypted = sealed(&Cfg)
+	fileCfg = Cfg
+}
+
+// savedToken return the token in the file
+func savedToken(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c appcfg
+	if err = json.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c.Token
+}
+
+func TestSealValue(t *testing.T) {
+	s, err := sealValue("token", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := sealValue("token", "pass")
+	if !strings.HasPrefix(s, secretPrefix) || strings.Contains(s, "token") || s == again {
+		t.Fatalf("bad sealed values %s %s", s, again)
+	}
+	if plain, err := openValue(s, "pass"); err != nil || plain != "token" {
+		t.Fatalf("open got %q %v", plain, err)
+	}
+	short := secretPrefix + base64.StdEncoding.EncodeToString(make([]byte, saltSize+4))
+	for value, want := range map[string]string{
+		s:                         "wrong passphrase",
+		secretPrefix + "!!!":      "malformed value",
+		secretPrefix + "AAAA":     "malformed value",
+		short:                     "malformed value",
+		s[:len(s)-8] + "AAAAAAAA": "wrong passphrase",
+	} {
+		pass := "pass"
+		if value == s {
+			pass = "other"
+		}
+		if _, err := openValue(value, pass); err == nil || err.Error() != want {
+			t.Errorf("open %s got %v want %s", value, err, want)
+		}
+	}
+}
+
+func TestSaveEncrypted(t *testing.T) {
+	file := useTempConfig(t)
+	Cfg.Token = "token"
+	if err := Encrypt("pass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	sealedToken := savedToken(t, file)
+	if !strings.HasPrefix(sealedToken, secretPrefix) || Cfg.Token != "token" {
+		t.Fatalf("token is not encrypted in the file: %s , memory %s", sealedToken, Cfg.Token)
+	}
+	reload(t)
+	if !Locked() || !Encrypted() {
+		t.Fatal("reloaded config is not locked")
+	}
+	t.Setenv("DISK_PASSPHRASE", "other")
+	if err := Unlock(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("wrong passphrase got %v", err)
+	}
+	if !Locked() || passphrase != "" {
+		t.Fatal("a wrong passphrase is kept")
+	}
+	t.Setenv("DISK_PASSPHRASE", "pass")
+	if err := Unlock(); err != nil || Cfg.Token != "token" || Locked() {
+		t.Fatalf("unlock got %q %v", Cfg.Token, err)
+	}
+}
+
+func TestSaveKeepsSealed(t *testing.T) {
+	file := useTempConfig(t)
+	Cfg.Token = "token"
+	if err := Encrypt("pass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	sealedToken := savedToken(t, file)
+	// 未解锁时保存其他配置, 密文原样保留且不询问口令
+	reload(t)
+	Cfg.Root = "/apps/x"
+	if err := Cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := savedToken(t, file); got != sealedToken {
+		t.Fatalf("sealed token changed to %s", got)
+	}
+	// 未解锁时修改密钥, 口令需要和文件中的密文一致
+	reload(t)
+	Cfg.Token = "new"
+	t.Setenv("DISK_PASSPHRASE", "other")
+	if err := Cfg.Save(); err == nil {
+		t.Fatal("a secret is saved with a wrong passphrase")
+	}
+	t.Setenv("DISK_PASSPHRASE", "pass")
+	if err := Cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := openValue(savedToken(t, file), "pass"); err != nil || plain != "new" {
+		t.Fatalf("saved token %q %v", plain, err)
+	}
+	if err := Decrypt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := savedToken(t, file); got != "new" {
+		t.Fatalf("decrypted token saved as %s", got)
+	}
+}
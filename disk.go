@@ -42,8 +42,15 @@ var sysStatus struct {
 }
 
 func main() {
+	// 配置文件损坏时只允许 config 命令, 补全时不输出错误
+	if err := config.Error(); err != nil && (len(os.Args) < 2 || os.Args[1] != "config" && os.Args[1] != "__complete") {
+		util.Log.Print(err)
+		os.Exit(1)
+	}
 	if len(os.Args) > 1 {
-		cli()
+		if code := commands.Dispatch(); code != 0 {
+			os.Exit(code)
+		}
 	} else {
 		err := daemon()
 		if err != nil {
@@ -52,65 +59,6 @@ func main() {
 	}
 }
 
-func cli() {
-	switch os.Args[1] {
-	case "ls":
-		commands.Ls()
-	case "cd":
-		commands.Cd()
-	case "pwd":
-		commands.Pwd()
-	case "cp":
-		commands.Cp()
-	case "mv":
-		commands.Mv()
-	case "mkdir":
-		commands.Mkdir()
-	case "rm":
-		commands.Rm()
-	case "get":
-		commands.Get()
-	case "put":
-		commands.Put()
-	case "wget":
-		commands.Wget()
-	case "info":
-		commands.Info()
-	case "hash", "sha1", "sha1sum":
-		commands.Hash("sha1")
-	case "sha256":
-		commands.Hash("sha256")
-	case "md5", "md5sum":
-		commands.Hash("md5")
-	case "crc32":
-		commands.Hash("crc32")
-	case "play":
-		commands.Play()
-	case "help":
-		commands.Help()
-	case "task":
-		commands.Task()
-	case "search":
-		commands.Search()
-	case "empty":
-		commands.Empty()
-	case "serve":
-		commands.Serve()
-	case "proxy":
-		commands.Proxy()
-	case "reverse":
-		commands.HTTPProxy()
-	case "nc":
-		commands.Nc()
-	case "fwd":
-		commands.Fwd()
-	case "network":
-		commands.Network()
-	default:
-		commands.Usage()
-	}
-}
-
 func daemon() error {
 	d := os.Getenv("DOC")
 	if d != "" {
@@ -193,18 +141,19 @@ func tryFiles(files []string, w http.ResponseWriter, r *http.Request) bool {
 	return false
 }
 
+// configs set the token by POST, GET only tells whether it is set, the token is never sent back
 func configs(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Auth") == os.Getenv("AUTH") {
-		token := r.Header.Get("Token")
-		if r.Method == http.MethodGet {
-			h := w.Header()
-			if token != "" {
-				h.Add("Token", config.Cfg.Token)
-			}
-		} else if r.Method == http.MethodPost {
-			if token != "" {
-				config.Cfg.Token = token
-			}
+	auth := os.Getenv("AUTH")
+	if auth == "" || r.Header.Get("Auth") != auth {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	token := r.Header.Get("Token")
+	if r.Method == http.MethodGet {
+		w.Header().Set("Token-Set", strconv.FormatBool(config.Cfg.Token != ""))
+	} else if r.Method == http.MethodPost {
+		if token != "" {
+			config.Cfg.Token = token
 		}
 	}
 }
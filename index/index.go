@@ -0,0 +1,181 @@
+package index
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suconghou/netdisk/layers/baidudisk"
+	"github.com/suconghou/netdisk/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	filesBucket = []byte("files")
+	metaBucket  = []byte("meta")
+)
+
+// Index is a local snapshot of the remote tree, keyed by path relative to root
+type Index struct {
+	db *bolt.DB
+}
+
+// Meta is the state of the last update
+type Meta struct {
+	Root    string
+	Cursor  string
+	Updated int64
+}
+
+// DefaultPath return the index file under the user cache dir
+func DefaultPath() string {
+	return filepath.Join(util.CacheDir(), "index.db")
+}
+
+// Open open or create the index file
+func Open(file string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{filesBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Index{db: db}, nil
+}
+
+// Close close the index file
+func (x *Index) Close() error {
+	return x.db.Close()
+}
+
+// Meta return the root and cursor of the last update
+func (x *Index) Meta() Meta {
+	var m Meta
+	x.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(metaBucket)
+		m.Root = string(b.Get([]byte("root")))
+		m.Cursor = string(b.Get([]byte("cursor")))
+		m.Updated, _ = strconv.ParseInt(string(b.Get([]byte("updated"))), 10, 64)
+		return nil
+	})
+	return m
+}
+
+// Apply write one page of changes and the cursor after it in a transaction, reset clear the snapshot first
+func (x *Index) Apply(root string, cursor string, reset bool, changes []baidudisk.Change) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		if reset {
+			if err := tx.DeleteBucket(filesBucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(filesBucket); err != nil {
+				return err
+			}
+		}
+		b := tx.Bucket(filesBucket)
+		for _, c := range changes {
+			if c.Type == baidudisk.ChangeDeleted {
+				if err := deleteTree(b, c.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			v, err := json.Marshal(c.FileItem)
+			if err != nil {
+				return err
+			}
+			if err = b.Put([]byte(c.Path), v); err != nil {
+				return err
+			}
+		}
+		m := tx.Bucket(metaBucket)
+		for k, v := range map[string]string{"root": root, "cursor": cursor, "updated": strconv.FormatInt(time.Now().Unix(), 10)} {
+			if err := m.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteTree delete p and the entries under it, a deleted dir may not list its children
+func deleteTree(b *bolt.Bucket, p string) error {
+	if err := b.Delete([]byte(p)); err != nil {
+		return err
+	}
+	var (
+		prefix = []byte(strings.TrimSuffix(p, "/") + "/")
+		keys   [][]byte
+		c      = b.Cursor()
+	)
+	for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query return the entries under dir which match the filter, in path order
+func (x *Index) Query(dir string, filter *baidudisk.Filter) ([]baidudisk.FileItem, error) {
+	var items []baidudisk.FileItem
+	err := x.db.View(func(tx *bolt.Tx) error {
+		var (
+			prefix = []byte(strings.TrimSuffix(dir, "/") + "/")
+			c      = tx.Bucket(filesBucket).Cursor()
+		)
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			if len(k) == len(prefix) {
+				continue
+			}
+			var item baidudisk.FileItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			if filter.Match(item) {
+				items = append(items, item)
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+// Stats return the count of files and dirs and the total size
+func (x *Index) Stats() (files int, dirs int, size uint64, err error) {
+	err = x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(filesBucket).ForEach(func(k, v []byte) error {
+			var item baidudisk.FileItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			if item.IsDir {
+				dirs++
+			} else {
+				files++
+				size += item.Size
+			}
+			return nil
+		})
+	})
+	return
+}
@@ -0,0 +1,120 @@
+package baidudisk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/suconghou/utilgo"
+)
+
+// sweepEvery is how often put removes the expired entries of all paths
+const sweepEvery = 10 * time.Minute
+
+// cache keep the list and meta responses on disk for ttl
+type cache struct {
+	dir   string
+	ttl   time.Duration
+	token string
+}
+
+// SetCache cache the list and meta responses under dir for ttl, ttl <= 0 disables it and dir is never created
+func (bc *Bclient) SetCache(dir string, ttl time.Duration) {
+	if ttl <= 0 || dir == "" {
+		bc.cache = nil
+		return
+	}
+	bc.cache = &cache{dir: dir, ttl: ttl, token: bc.token}
+}
+
+// file return the cache file of method and the full remote path, the token is hashed in so accounts do not share entries
+func (c *cache) file(method string, p string) string {
+	sum := sha1.Sum([]byte(c.token + ":" + method + ":" + p))
+	return filepath.Join(c.dir, method+"-"+hex.EncodeToString(sum[:]))
+}
+
+func (c *cache) get(method string, p string) ([]byte, bool) {
+	file := c.file(method, p)
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, false
+	}
+	if time.Since(info.ModTime()) > c.ttl {
+		os.Remove(file)
+		return nil, false
+	}
+	body, err := ioutil.ReadFile(file)
+	return body, err == nil
+}
+
+func (c *cache) put(method string, p string, body []byte) {
+	// 出错的响应不缓存
+	if bytes.Contains(body, []byte(`"error_msg"`)) {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return
+	}
+	tmp := c.file(method, p) + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, c.file(method, p))
+	c.sweep()
+}
+
+// sweep remove the expired entries at most once every sweepEvery, the mtime of the sweep file is the last run
+func (c *cache) sweep() {
+	mark := filepath.Join(c.dir, "sweep")
+	if info, err := os.Stat(mark); err == nil && time.Since(info.ModTime()) < sweepEvery {
+		return
+	}
+	if err := ioutil.WriteFile(mark, nil, 0600); err != nil {
+		return
+	}
+	for _, method := range []string{"list", "meta"} {
+		files, _ := filepath.Glob(filepath.Join(c.dir, method+"-*"))
+		for _, f := range files {
+			if info, err := os.Stat(f); err == nil && time.Since(info.ModTime()) > c.ttl {
+				os.Remove(f)
+			}
+		}
+	}
+}
+
+// clear drop all the cached responses, a mutation may change any parent dir
+func (c *cache) clear() {
+	for _, method := range []string{"list", "meta"} {
+		files, _ := filepath.Glob(filepath.Join(c.dir, method+"-*"))
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+}
+
+// fetch get url of method on p through the cache
+func (bc *Bclient) fetch(method string, p string, url string) ([]byte, error) {
+	p = path.Join(bc.root, p)
+	if bc.cache != nil {
+		if body, ok := bc.cache.get(method, p); ok {
+			return body, nil
+		}
+	}
+	body, err := utilgo.GetContent(url, 10)
+	if err == nil && bc.cache != nil {
+		bc.cache.put(method, p, body)
+	}
+	return body, err
+}
+
+// invalidate is called after a mutation
+func (bc *Bclient) invalidate() {
+	if bc.cache != nil {
+		bc.cache.clear()
+	}
+}
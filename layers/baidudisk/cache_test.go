@@ -0,0 +1,96 @@
+package baidudisk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// age set the mtime of file to d ago
+func age(t *testing.T, file string, d time.Duration) {
+	old := time.Now().Add(-d)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cached(c *cache, method string, p string) bool {
+	_, err := os.Stat(c.file(method, p))
+	return err == nil
+}
+
+func TestCacheGet(t *testing.T) {
+	c := &cache{dir: t.TempDir(), ttl: time.Minute, token: "t1"}
+	c.put("list", "/a", []byte(`{"list":[]}`))
+	if body, ok := c.get("list", "/a"); !ok || string(body) != `{"list":[]}` {
+		t.Fatalf("fresh entry got %q %v", body, ok)
+	}
+	if _, ok := c.get("meta", "/a"); ok {
+		t.Fatal("list entry is returned for meta")
+	}
+	other := &cache{dir: c.dir, ttl: time.Minute, token: "t2"}
+	if _, ok := other.get("list", "/a"); ok {
+		t.Fatal("entry of another token is returned")
+	}
+	age(t, c.file("list", "/a"), 2*time.Minute)
+	if _, ok := c.get("list", "/a"); ok {
+		t.Fatal("expired entry is returned")
+	}
+	if cached(c, "list", "/a") {
+		t.Fatal("expired entry is not removed on read")
+	}
+	c.put("meta", "/b", []byte(`{"error_code":31066,"error_msg":"file does not exist"}`))
+	if cached(c, "meta", "/b") {
+		t.Fatal("error response is cached")
+	}
+}
+
+func TestCacheSweep(t *testing.T) {
+	c := &cache{dir: t.TempDir(), ttl: time.Minute}
+	c.put("list", "/stale", []byte("{}"))
+	age(t, c.file("list", "/stale"), 2*time.Minute)
+	// 上次清理不到 sweepEvery, 过期的条目留到读取或下次清理
+	c.put("list", "/a", []byte("{}"))
+	if !cached(c, "list", "/stale") {
+		t.Fatal("sweep is not throttled")
+	}
+	age(t, filepath.Join(c.dir, "sweep"), sweepEvery+time.Minute)
+	c.put("meta", "/b", []byte("{}"))
+	if cached(c, "list", "/stale") {
+		t.Fatal("expired entry is not swept")
+	}
+	if !cached(c, "list", "/a") || !cached(c, "meta", "/b") {
+		t.Fatal("fresh entries are swept")
+	}
+}
+
+func TestCacheClear(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		bc  = NewClient("t", "/apps/x")
+	)
+	bc.SetCache(dir, time.Minute)
+	bc.cache.put("list", "/apps/x/a", []byte("{}"))
+	bc.cache.put("meta", "/apps/x/a/b", []byte("{}"))
+	bc.invalidate()
+	files, _ := filepath.Glob(filepath.Join(dir, "*-*"))
+	if len(files) != 0 {
+		t.Fatalf("entries left after a mutation: %v", files)
+	}
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		bc.SetCache(filepath.Join(dir, "off"), ttl)
+		if bc.cache != nil {
+			t.Fatalf("ttl %v does not disable the cache", ttl)
+		}
+		bc.invalidate()
+	}
+	if _, err := os.Stat(filepath.Join(dir, "off")); !os.IsNotExist(err) {
+		t.Fatal("cache dir is created while disabled")
+	}
+	bc.SetCache(dir, time.Minute)
+	bc.SetToken("t2")
+	if bc.cache.token != "t2" {
+		t.Fatal("cache keeps the old token")
+	}
+}
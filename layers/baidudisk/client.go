@@ -4,16 +4,18 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
 	"time"
 
 	"github.com/bitly/go-simplejson"
+	"github.com/suconghou/netdisk/util"
 	"github.com/suconghou/utilgo"
 )
 
@@ -28,6 +30,10 @@ type Bclient struct {
 	uploadURL string
 	taskURL   string
 	infoURL   string
+	thumbURL  string
+	format    string
+	limiter   *util.Limiter
+	cache     *cache
 }
 
 type counter struct {
@@ -48,8 +54,14 @@ var taskStatusMap = map[string]string{
 	"7": "任务已取消",
 }
 
-// Log is a global logger
-var Log = log.New(os.Stdout, "", 0)
+// Log is a global logger, the secrets are hidden
+var Log = util.Log
+
+// Raw print the download link which carries the token
+var Raw = util.Raw
+
+// Warn print the errors which do not stop a command
+var Warn = util.Warn
 
 // NewClient return a client
 func NewClient(token string, root string) *Bclient {
@@ -60,6 +72,21 @@ func NewClient(token string, root string) *Bclient {
 		infoURL:   "https://pcs.baidu.com/rest/2.0/pcs/quota",
 		uploadURL: "https://c.pcs.baidu.com/rest/2.0/pcs/file",
 		taskURL:   "https://pan.baidu.com/rest/2.0/services/cloud_dl",
+		thumbURL:  "https://pcs.baidu.com/rest/2.0/pcs/thumbnail",
+		format:    FormatText,
+	}
+}
+
+// escPath return the full remote path of p escaped for the api urls
+func (bc *Bclient) escPath(p string) string {
+	return url.QueryEscape(path.Join(bc.root, p))
+}
+
+// SetToken replace the access token, like after the config is decrypted
+func (bc *Bclient) SetToken(token string) {
+	bc.token = token
+	if bc.cache != nil {
+		bc.cache.token = token
 	}
 }
 
@@ -87,36 +114,62 @@ func (bc *Bclient) Ls(p string) error {
 	if err != nil {
 		return err
 	}
+	items := newFileItems(js)
+	if ok, err := bc.emit(items, fileHeader, fileRows(items)); ok {
+		return err
+	}
+	b, total := listText(items)
+	Log.Printf("%s%s", name+bc.root+"  ➜  "+p+" "+utilgo.ByteFormat(total), b)
+	return nil
+}
+
+// listText format file items as text lines
+func listText(items []FileItem) (string, uint64) {
 	b := bytes.Buffer{}
 	var total uint64
-	for i := range js.Get("list").MustArray() {
-		item := js.Get("list").GetIndex(i)
-		size := item.Get("size").MustUint64()
-		total = total + size
+	for _, item := range items {
+		total = total + item.Size
 		b.WriteString("\n")
-		b.WriteString(fmt.Sprintf("%-22s", utilgo.DateFormat(item.Get("ctime").MustInt64())))
-		b.WriteString(fmt.Sprintf("%-22s", utilgo.DateFormat(item.Get("mtime").MustInt64())))
-		b.WriteString(fmt.Sprintf("%-10s", utilgo.ByteFormat(size)))
-		b.WriteString(fmt.Sprintf("%-20s", item.Get("path").MustString()))
+		b.WriteString(fmt.Sprintf("%-22s", utilgo.DateFormat(item.Ctime)))
+		b.WriteString(fmt.Sprintf("%-22s", utilgo.DateFormat(item.Mtime)))
+		b.WriteString(fmt.Sprintf("%-10s", utilgo.ByteFormat(item.Size)))
+		b.WriteString(fmt.Sprintf("%-20s", item.Path))
 	}
-	Log.Printf("%s%s", name+bc.root+"  ➜  "+p+" "+utilgo.ByteFormat(total), b.String())
-	return nil
+	return b.String(), total
 }
 
 // APILsURL return ls url string
 func (bc *Bclient) APILsURL(p string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "list", bc.token, path.Join(bc.root, p))
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "list", bc.token, bc.escPath(p))
 }
 
 // APILs response ls
 func (bc *Bclient) APILs(p string) (*simplejson.Json, error) {
-	body, err := utilgo.GetContent(bc.APILsURL(p), 10)
+	body, err := bc.APILsBody(p)
 	if err != nil {
 		return nil, err
 	}
 	return simplejson.NewJson(body)
 }
 
+// APILsBody return the ls resp body, may be cached
+func (bc *Bclient) APILsBody(p string) ([]byte, error) {
+	return bc.fetch("list", p, bc.APILsURL(p))
+}
+
+// List return the items of dir
+func (bc *Bclient) List(p string) ([]FileItem, error) {
+	js, err := bc.APILs(p)
+	if err != nil {
+		return nil, err
+	}
+	errMsg := js.Get("error_msg").MustString()
+	if errMsg != "" {
+		return nil, errors.New(errMsg)
+	}
+	return newFileItems(js), nil
+}
+
 // Cd show files list
 func (bc *Bclient) Cd(p string) error {
 	bc.path = p
@@ -139,12 +192,13 @@ func (bc *Bclient) Mkdir(p string) error {
 
 // APIMkdirURL return mkdir api url
 func (bc *Bclient) APIMkdirURL(p string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "mkdir", bc.token, path.Join(bc.root, p))
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "mkdir", bc.token, bc.escPath(p))
 }
 
 // APIMkdir return api resp
 func (bc *Bclient) APIMkdir(p string) (*simplejson.Json, error) {
 	body, err := utilgo.PostContent(bc.APIMkdirURL(p), "application/x-www-form-urlencoded", nil, nil)
+	bc.invalidate()
 	if err != nil {
 		return nil, err
 	}
@@ -167,12 +221,13 @@ func (bc *Bclient) Mv(source string, target string) error {
 
 // APIMvURL return mv api url
 func (bc *Bclient) APIMvURL(source string, target string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&from=%s&to=%s", bc.apiURL, "move", bc.token, path.Join(bc.root, source), path.Join(bc.root, target))
+	return fmt.Sprintf("%s?method=%s&access_token=%s&from=%s&to=%s", bc.apiURL, "move", bc.token, bc.escPath(source), bc.escPath(target))
 }
 
 // APIMv return mv resp
 func (bc *Bclient) APIMv(source string, target string) (*simplejson.Json, error) {
 	body, err := utilgo.PostContent(bc.APIMvURL(source, target), "application/x-www-form-urlencoded", nil, nil)
+	bc.invalidate()
 	if err != nil {
 		return nil, err
 	}
@@ -195,12 +250,13 @@ func (bc *Bclient) Cp(source string, target string) error {
 
 // APICpURL return cp url
 func (bc *Bclient) APICpURL(source string, target string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&from=%s&to=%s", bc.apiURL, "copy", bc.token, path.Join(bc.root, source), path.Join(bc.root, target))
+	return fmt.Sprintf("%s?method=%s&access_token=%s&from=%s&to=%s", bc.apiURL, "copy", bc.token, bc.escPath(source), bc.escPath(target))
 }
 
 // APICp return cp resp
 func (bc *Bclient) APICp(source string, target string) (*simplejson.Json, error) {
 	body, err := utilgo.PostContent(bc.APICpURL(source, target), "application/x-www-form-urlencoded", nil, nil)
+	bc.invalidate()
 	if err != nil {
 		return nil, err
 	}
@@ -223,12 +279,13 @@ func (bc *Bclient) Rm(file string) error {
 
 // APIRmURL return rm api url
 func (bc *Bclient) APIRmURL(file string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "delete", bc.token, path.Join(bc.root, file))
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "delete", bc.token, bc.escPath(file))
 }
 
 // APIRm return rm resp
 func (bc *Bclient) APIRm(file string) (*simplejson.Json, error) {
 	body, err := utilgo.PostContent(bc.APIRmURL(file), "application/x-www-form-urlencoded", nil, nil)
+	bc.invalidate()
 	if err != nil {
 		return nil, err
 	}
@@ -251,7 +308,7 @@ func (bc *Bclient) APIGet(file string) (io.ReadCloser, error) {
 
 // GetDownloadURL return download url
 func (bc *Bclient) GetDownloadURL(file string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "download", bc.token, path.Join(bc.root, file))
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "download", bc.token, bc.escPath(file))
 }
 
 // Put upload files may use rapid upload
@@ -280,13 +337,18 @@ func (bc *Bclient) Put(savePath string, overwrite bool, file *os.File) error {
 	return nil
 }
 
+// SetLimiter limit the upload speed, nil means unlimited
+func (bc *Bclient) SetLimiter(l *util.Limiter) {
+	bc.limiter = l
+}
+
 // APIPutURL return upload url
 func (bc *Bclient) APIPutURL(savePath string, overwrite bool) string {
 	ondup := "newcopy"
 	if overwrite {
 		ondup = "overwrite"
 	}
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&ondup=%s", bc.uploadURL, "upload", bc.token, path.Join(bc.root, savePath), ondup)
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&ondup=%s", bc.uploadURL, "upload", bc.token, bc.escPath(savePath), ondup)
 }
 
 // APIPut return put resp
@@ -310,7 +372,9 @@ func (bc *Bclient) APIPut(savePath string, overwrite bool, file *os.File, filesi
 	} else {
 		r = bodyBuf
 	}
+	r = util.LimitReader(r, bc.limiter)
 	body, err := utilgo.PostContent(bc.APIPutURL(savePath, overwrite), bodyWriter.FormDataContentType(), r, nil)
+	bc.invalidate()
 	if err != nil {
 		return nil, err
 	}
@@ -336,7 +400,7 @@ func (bc *Bclient) APIRapidPutURL(savePath string, fileSize int64, md5Str string
 	if overwrite {
 		ondup = "overwrite"
 	}
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&content-length=%d&content-md5=%s&slice-md5=%s&content-crc32=%s&ondup=%s", bc.uploadURL, "rapidupload", bc.token, path.Join(bc.root, savePath), fileSize, md5Str, sliceMd5, contentCrc32, ondup)
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&content-length=%d&content-md5=%s&slice-md5=%s&content-crc32=%s&ondup=%s", bc.uploadURL, "rapidupload", bc.token, bc.escPath(savePath), fileSize, md5Str, sliceMd5, contentCrc32, ondup)
 }
 
 // APIRapidPut return RapidPut resp
@@ -360,6 +424,7 @@ func (bc *Bclient) APIRapidPut(file *os.File, savePath string, overwrite bool) (
 	file.ReadAt(slice, 0)
 	sliceMd5 := fmt.Sprintf("%x", md5.Sum(slice))
 	body, err := utilgo.PostContent(bc.APIRapidPutURL(savePath, fileSize, contentMd5, sliceMd5, contentCrc32, overwrite), "application/x-www-form-urlencoded", nil, nil)
+	bc.invalidate()
 	defer file.Seek(0, 0)
 	if err != nil {
 		return "", "", "", nil, err
@@ -374,9 +439,13 @@ func (bc *Bclient) Info() error {
 	if err != nil {
 		return err
 	}
-	b := bytes.Buffer{}
 	quota := js.Get("quota").MustUint64()
 	used := js.Get("used").MustUint64()
+	row := []string{strconv.FormatUint(quota, 10), strconv.FormatUint(used, 10)}
+	if ok, err := bc.emit(diskInfo{Quota: quota, Used: used}, []string{"quota", "used"}, [][]string{row}); ok {
+		return err
+	}
+	b := bytes.Buffer{}
 	b.WriteString(name + "\n总大小:" + utilgo.ByteFormat(quota))
 	b.WriteString("\n已使用:" + utilgo.ByteFormat(used))
 	b.WriteString(fmt.Sprintf("\n利用率:%.1f%%", float32(used)/float32(quota)*100))
@@ -408,76 +477,100 @@ func (bc *Bclient) FileInfo(p string, dlink bool) error {
 	if errMsg != "" {
 		return fmt.Errorf(errMsg)
 	}
-	b := bytes.Buffer{}
 	item := js.Get("list").GetIndex(0)
-	b.WriteString(name + item.Get("path").MustString())
-	b.WriteString("\n文件类型:" + utilgo.BoolString(item.Get("isdir").MustInt() == 0, "文件", "文件夹"))
-	b.WriteString("\n文件大小:" + utilgo.ByteFormat(item.Get("size").MustUint64()))
-	b.WriteString(fmt.Sprintf("\n文件字节:%d\n文件标识:%d", item.Get("size").MustInt64(), item.Get("fs_id").MustInt64()))
-	b.WriteString("\n创建时间:" + utilgo.DateFormat(item.Get("ctime").MustInt64()))
-	b.WriteString("\n修改时间:" + utilgo.DateFormat(item.Get("mtime").MustInt64()))
-	blockstr := item.Get("block_list").MustString()
-	if blockstr != "" {
-		blocks, err := simplejson.NewJson([]byte(item.Get("block_list").MustString()))
-		if err != nil {
-			Log.Print(b.String())
-			return err
+	blocksarr, blockErr := blockList(item)
+	detail := fileDetail{FileItem: newFileItem(item), Blocks: blocksarr}
+	out := Log
+	if dlink {
+		// 链接带有 token, 只在明确要求时原样输出
+		detail.Link = bc.GetDownloadURL(p)
+		out = Raw
+	}
+	if ok, err := bc.emitTo(out, detail, append(fileHeader, "link"), [][]string{append(detail.row(), detail.Link)}); ok {
+		if err == nil {
+			err = blockErr
 		}
-		blocksarr := blocks.MustStringArray()
-		if len(blocksarr) == 1 {
-			b.WriteString("\n文件哈希:" + blocksarr[0])
-		} else {
-			for _, v := range blocksarr {
-				b.WriteString("\n哈希块:" + v)
-			}
+		return err
+	}
+	b := bytes.Buffer{}
+	b.WriteString(name + detail.Path)
+	b.WriteString("\n文件类型:" + utilgo.BoolString(!detail.IsDir, "文件", "文件夹"))
+	b.WriteString("\n文件大小:" + utilgo.ByteFormat(detail.Size))
+	b.WriteString(fmt.Sprintf("\n文件字节:%d\n文件标识:%d", detail.Size, detail.FsID))
+	b.WriteString("\n创建时间:" + utilgo.DateFormat(detail.Ctime))
+	b.WriteString("\n修改时间:" + utilgo.DateFormat(detail.Mtime))
+	if blockErr != nil {
+		Log.Print(b.String())
+		return blockErr
+	}
+	if len(blocksarr) == 1 {
+		b.WriteString("\n文件哈希:" + blocksarr[0])
+	} else {
+		for _, v := range blocksarr {
+			b.WriteString("\n哈希块:" + v)
 		}
 	}
 	if dlink {
-		b.WriteString("\n下载地址:" + bc.GetDownloadURL(p))
+		b.WriteString("\n下载地址:" + detail.Link)
 	}
-	Log.Print(b.String())
+	out.Print(b.String())
 	return nil
 }
 
 // APIFileInfoURL return fileinfo url
 func (bc *Bclient) APIFileInfoURL(file string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "meta", bc.token, path.Join(bc.root, file))
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s", bc.apiURL, "meta", bc.token, bc.escPath(file))
 }
 
 // APIFileInfo response info
 func (bc *Bclient) APIFileInfo(file string) (*simplejson.Json, error) {
-	body, err := utilgo.GetContent(bc.APIFileInfoURL(file), 10)
+	body, err := bc.APIFileInfoBody(file)
 	if err != nil {
 		return nil, err
 	}
 	return simplejson.NewJson(body)
 }
 
+// APIFileInfoBody return the meta resp body, may be cached
+func (bc *Bclient) APIFileInfoBody(file string) ([]byte, error) {
+	return bc.fetch("meta", file, bc.APIFileInfoURL(file))
+}
+
+// Stat return the file/dir item
+func (bc *Bclient) Stat(p string) (*FileItem, error) {
+	js, err := bc.APIFileInfo(p)
+	if err != nil {
+		return nil, err
+	}
+	errMsg := js.Get("error_msg").MustString()
+	if errMsg != "" {
+		return nil, errors.New(errMsg)
+	}
+	if len(js.Get("list").MustArray()) == 0 {
+		return nil, fmt.Errorf("%s not found", p)
+	}
+	item := newFileItem(js.Get("list").GetIndex(0))
+	return &item, nil
+}
+
 // Search search files
 func (bc *Bclient) Search(fileName string) error {
 	js, err := bc.APISearch(fileName)
 	if err != nil {
 		return err
 	}
-	b := bytes.Buffer{}
-	var total uint64
-	for i := range js.Get("list").MustArray() {
-		item := js.Get("list").GetIndex(i)
-		size := item.Get("size").MustUint64()
-		total = total + size
-		b.WriteString("\n")
-		b.WriteString(fmt.Sprintf("%-22s", utilgo.DateFormat(item.Get("ctime").MustInt64())))
-		b.WriteString(fmt.Sprintf("%-22s", utilgo.DateFormat(item.Get("mtime").MustInt64())))
-		b.WriteString(fmt.Sprintf("%-10s", utilgo.ByteFormat(size)))
-		b.WriteString(fmt.Sprintf("%-20s", item.Get("path").MustString()))
+	items := newFileItems(js)
+	if ok, err := bc.emit(items, fileHeader, fileRows(items)); ok {
+		return err
 	}
-	Log.Printf("%s\n%s", name+bc.root+"  ➜  搜索["+fileName+"] "+utilgo.ByteFormat(total), b.String())
+	b, total := listText(items)
+	Log.Printf("%s\n%s", name+bc.root+"  ➜  搜索["+fileName+"] "+utilgo.ByteFormat(total), b)
 	return nil
 }
 
 // APISearchURL return api search url
 func (bc *Bclient) APISearchURL(name string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&wd=%s&re=%s", bc.apiURL, "search", bc.token, bc.root, name, "1")
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&wd=%s&re=%s", bc.apiURL, "search", bc.token, url.QueryEscape(bc.root), url.QueryEscape(name), "1")
 }
 
 // APISearch return search resp
@@ -510,12 +603,11 @@ func (bc *Bclient) TaskAdd(savePath string, url string) error {
 
 // APITaskAddURL retrun taskadd url
 func (bc *Bclient) APITaskAddURL(savePath string, sourceURL string) string {
-	return fmt.Sprintf("%s?method=%s&access_token=%s&save_path=%s&source_url=%s&app_id=250528", bc.taskURL, "add_task", bc.token, savePath, sourceURL)
+	return fmt.Sprintf("%s?method=%s&access_token=%s&save_path=%s&source_url=%s&app_id=250528", bc.taskURL, "add_task", bc.token, bc.escPath(savePath), url.QueryEscape(sourceURL))
 }
 
 // APITaskAdd return taskadd resp
 func (bc *Bclient) APITaskAdd(savePath string, sourceURL string) (*simplejson.Json, error) {
-	savePath = path.Join(bc.root, savePath)
 	body, err := utilgo.PostContent(bc.APITaskAddURL(savePath, sourceURL), "application/x-www-form-urlencoded", nil, nil)
 	if err != nil {
 		return nil, err
@@ -529,17 +621,20 @@ func (bc *Bclient) TaskList() error {
 	if err != nil {
 		return err
 	}
-	b := bytes.Buffer{}
+	tasks := []TaskItem{}
+	rows := [][]string{}
 	for i := range js.Get("task_info").MustArray() {
 		item := js.Get("task_info").GetIndex(i)
-		id := item.Get("task_id").MustString()
-		name := item.Get("task_name").MustString()
-		t, _ := strconv.ParseInt(item.Get("create_time").MustString(), 10, 64)
-		createTime := utilgo.DateFormat(t)
-		status := showTaskStatus(item.Get("status").MustString())
-		sourceURL := item.Get("source_url").MustString()
-		savePath := item.Get("save_path").MustString()
-		b.WriteString(fmt.Sprintf("\n任务ID:%s\n任务名称:%s\n创建时间:%s\n任务状态:%s\n源地址:%s \n存储至:%s\n", id, name, createTime, status, sourceURL, savePath))
+		t := newTaskItem(item.Get("task_id").MustString(), item)
+		tasks = append(tasks, t)
+		rows = append(rows, t.row())
+	}
+	if ok, err := bc.emit(tasks, taskHeader, rows); ok {
+		return err
+	}
+	b := bytes.Buffer{}
+	for _, t := range tasks {
+		b.WriteString(fmt.Sprintf("\n任务ID:%s\n任务名称:%s\n创建时间:%s\n任务状态:%s\n源地址:%s \n存储至:%s\n", t.ID, t.Name, utilgo.DateFormat(t.CreateTime), t.StatusText, t.SourceURL, t.SavePath))
 	}
 	Log.Printf("%s%s  ➜  离线任务: %d个任务 %s", name, bc.root, js.Get("total").MustInt(), b.String())
 	return nil
@@ -569,17 +664,21 @@ func (bc *Bclient) TaskInfo(ids string) error {
 	if errMsg != "" {
 		return fmt.Errorf(errMsg)
 	}
+	tasks := []TaskItem{}
+	rows := [][]string{}
+	for id := range js.Get("task_info").MustMap() {
+		t := newTaskItem(id, js.Get("task_info").Get(id))
+		tasks = append(tasks, t)
+		rows = append(rows, t.row())
+	}
+	if ok, err := bc.emit(tasks, taskHeader, rows); ok {
+		return err
+	}
 	b := bytes.Buffer{}
 	timestamp := time.Now().Unix()
-	for id := range js.Get("task_info").MustMap() {
-		item := js.Get("task_info").Get(id)
-		name := item.Get("task_name").MustString()
-		status := showTaskStatus(item.Get("status").MustString())
-		createTime, _ := strconv.ParseInt(item.Get("create_time").MustString(), 10, 64)
-		startTime, _ := strconv.ParseInt(item.Get("create_time").MustString(), 10, 64)
-		b.WriteString(fmt.Sprintf("\n任务ID:%s\n任务名称:%s\n任务状态:%s\n创建时间:%s\n开始下载时间:%s\n", id, name, status, utilgo.DateFormat(createTime), utilgo.DateFormat(startTime)))
-		fileSize, _ := strconv.ParseUint(item.Get("file_size").MustString(), 10, 64)
-		finishTime, _ := strconv.ParseInt(item.Get("finish_time").MustString(), 10, 64)
+	for _, t := range tasks {
+		startTime, fileSize, finishTime := t.StartTime, t.FileSize, t.FinishTime
+		b.WriteString(fmt.Sprintf("\n任务ID:%s\n任务名称:%s\n任务状态:%s\n创建时间:%s\n开始下载时间:%s\n", t.ID, t.Name, t.StatusText, utilgo.DateFormat(t.CreateTime), utilgo.DateFormat(startTime)))
 		if fileSize > 0 { //已探测出文件大小
 			b.WriteString(fmt.Sprintf("大小:%d (%s)\n", fileSize, utilgo.ByteFormat(fileSize)))
 			if finishTime > startTime { //已下载完毕
@@ -588,12 +687,12 @@ func (bc *Bclient) TaskInfo(ids string) error {
 			} else if finishTime > 0 && finishTime == startTime {
 				b.WriteString(fmt.Sprintf("任务完成时间:%s 云端已秒杀 \n", utilgo.DateFormat(finishTime)))
 			} else {
-				finishedSize, _ := strconv.ParseUint(item.Get("finished_size").MustString(), 10, 64)
+				finishedSize := t.FinishedSize
 				duration := int64(timestamp) - startTime
 				b.WriteString(fmt.Sprintf("已下载:%s 进度:%.1f%% 速度:%.2fKB/s\n", utilgo.ByteFormat(finishedSize), float64(finishedSize)/float64(fileSize)*100, float64(finishedSize)/1024/float64(duration)))
 			}
 		}
-		b.WriteString(fmt.Sprintf("原地址:%s\n存储至:%s\n", item.Get("source_url").MustString(), item.Get("save_path").MustString()))
+		b.WriteString(fmt.Sprintf("原地址:%s\n存储至:%s\n", t.SourceURL, t.SavePath))
 	}
 	Log.Printf("%s%s  ➜  任务详情: %s", name, bc.root, b.String())
 	return nil
@@ -669,6 +768,32 @@ func (bc *Bclient) APIClear() (*simplejson.Json, error) {
 	return simplejson.NewJson(body)
 }
 
+// newTaskItem parse one task of list_task/query_task resp
+func newTaskItem(id string, item *simplejson.Json) TaskItem {
+	createTime, _ := strconv.ParseInt(item.Get("create_time").MustString(), 10, 64)
+	startTime, _ := strconv.ParseInt(item.Get("start_time").MustString(), 10, 64)
+	if startTime == 0 {
+		startTime = createTime
+	}
+	finishTime, _ := strconv.ParseInt(item.Get("finish_time").MustString(), 10, 64)
+	fileSize, _ := strconv.ParseUint(item.Get("file_size").MustString(), 10, 64)
+	finishedSize, _ := strconv.ParseUint(item.Get("finished_size").MustString(), 10, 64)
+	status := item.Get("status").MustString()
+	return TaskItem{
+		ID:           id,
+		Name:         item.Get("task_name").MustString(),
+		Status:       status,
+		StatusText:   showTaskStatus(status),
+		CreateTime:   createTime,
+		StartTime:    startTime,
+		FinishTime:   finishTime,
+		FileSize:     fileSize,
+		FinishedSize: finishedSize,
+		SourceURL:    item.Get("source_url").MustString(),
+		SavePath:     item.Get("save_path").MustString(),
+	}
+}
+
 func showTaskStatus(status string) string {
 	if v, ok := taskStatusMap[status]; ok {
 		return v
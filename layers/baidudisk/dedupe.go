@@ -0,0 +1,156 @@
+package baidudisk
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/suconghou/utilgo"
+)
+
+// dupSet is the Dedupe record
+type dupSet struct {
+	MD5    string   `json:"md5"`
+	Size   uint64   `json:"size"`
+	Wasted uint64   `json:"wasted"`
+	Keep   string   `json:"keep"`
+	Files  []string `json:"files"`
+}
+
+// Dedupe find files with the same size and md5, the duplicates can be deleted or moved
+func (bc *Bclient) Dedupe(p string, keep string, moveTo string, del bool, dryRun bool, workers int) error {
+	var (
+		bySize = map[uint64][]FileItem{}
+		sets   []dupSet
+		total  uint64
+	)
+	err := bc.Walk(p, -1, workers, func(dir string, items []FileItem) error {
+		for _, item := range items {
+			item.Path = bc.rel(item.Path)
+			if item.IsDir || item.Size == 0 || (moveTo != "" && underAny(item.Path, []string{moveTo})) {
+				continue
+			}
+			bySize[item.Size] = append(bySize[item.Size], item)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for size, items := range bySize {
+		if len(items) < 2 {
+			continue
+		}
+		byHash := map[string][]FileItem{}
+		for _, item := range items {
+			hash, err := bc.contentHash(item)
+			if err != nil {
+				return fmt.Errorf("%s: %v", item.Path, err)
+			}
+			byHash[hash] = append(byHash[hash], item)
+		}
+		for hash, group := range byHash {
+			if len(group) < 2 {
+				continue
+			}
+			sortKeep(group, keep)
+			set := dupSet{MD5: hash, Size: size, Wasted: size * uint64(len(group)-1), Keep: group[0].Path}
+			for _, item := range group {
+				set.Files = append(set.Files, item.Path)
+			}
+			sets = append(sets, set)
+			total += set.Wasted
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Wasted == sets[j].Wasted {
+			return sets[i].Keep < sets[j].Keep
+		}
+		return sets[i].Wasted > sets[j].Wasted
+	})
+	rows := [][]string{}
+	for _, set := range sets {
+		for _, f := range set.Files {
+			rows = append(rows, []string{set.MD5, strconv.FormatUint(set.Size, 10), strconv.FormatBool(f == set.Keep), f})
+		}
+	}
+	ok, err := bc.emit(sets, []string{"md5", "size", "keep", "path"}, rows)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		b := strings.Builder{}
+		b.WriteString(fmt.Sprintf("%s%s  ➜  %s 重复 %d组 可释放 %s", name, bc.root, p, len(sets), utilgo.ByteFormat(total)))
+		for _, set := range sets {
+			b.WriteString(fmt.Sprintf("\n\n%s %s x%d 浪费 %s", set.MD5, utilgo.ByteFormat(set.Size), len(set.Files), utilgo.ByteFormat(set.Wasted)))
+			for _, f := range set.Files {
+				b.WriteString("\n" + utilgo.BoolString(f == set.Keep, "  * ", "    ") + f)
+			}
+		}
+		Log.Print(b.String())
+	}
+	if !del && moveTo == "" {
+		return nil
+	}
+	for _, set := range sets {
+		for _, f := range set.Files[1:] {
+			if dryRun {
+				if del {
+					Log.Printf("将删除 %s", f)
+				} else {
+					Log.Printf("将移动 %s 至 %s", f, path.Join(moveTo, f))
+				}
+				continue
+			}
+			if del {
+				err = bc.Rm(f)
+			} else {
+				err = bc.Mv(f, path.Join(moveTo, f))
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", f, err)
+			}
+		}
+	}
+	return nil
+}
+
+// contentHash return md5 of list resp or the block_list of meta
+func (bc *Bclient) contentHash(item FileItem) (string, error) {
+	if item.MD5 != "" {
+		return item.MD5, nil
+	}
+	js, err := bc.APIFileInfo(item.Path)
+	if err != nil {
+		return "", err
+	}
+	if errMsg := js.Get("error_msg").MustString(); errMsg != "" {
+		return "", fmt.Errorf("%s", errMsg)
+	}
+	blocks, err := blockList(js.Get("list").GetIndex(0))
+	if err != nil {
+		return "", err
+	}
+	if len(blocks) == 0 {
+		return "", fmt.Errorf("no hash")
+	}
+	return strings.Join(blocks, ","), nil
+}
+
+// sortKeep put the file to keep at first, keep is oldest newest or shortest
+func sortKeep(items []FileItem, keep string) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch {
+		case keep == "newest" && a.Mtime != b.Mtime:
+			return a.Mtime > b.Mtime
+		case keep == "shortest" && len(a.Path) != len(b.Path):
+			return len(a.Path) < len(b.Path)
+		case keep == "oldest" && a.Mtime != b.Mtime:
+			return a.Mtime < b.Mtime
+		}
+		return a.Path < b.Path
+	})
+}
@@ -0,0 +1,133 @@
+package baidudisk
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/suconghou/utilgo"
+)
+
+// change type
+const (
+	ChangeCreated  = "CREATED"
+	ChangeModified = "MODIFIED"
+	ChangeDeleted  = "DELETED"
+)
+
+// Change is one entry of the diff feed
+type Change struct {
+	Type string `json:"type"`
+	FileItem
+}
+
+// DiffResult is one page of the diff feed
+type DiffResult struct {
+	Changes []Change
+	Cursor  string
+	HasMore bool
+	Reset   bool // the cursor is expired, the entries are a full listing
+}
+
+// APIDiffURL return diff url, cursor null means from the beginning
+func (bc *Bclient) APIDiffURL(cursor string) string {
+	if cursor == "" {
+		cursor = "null"
+	}
+	return fmt.Sprintf("%s?method=%s&access_token=%s&cursor=%s", bc.apiURL, "diff", bc.token, url.QueryEscape(cursor))
+}
+
+// APIDiff return diff resp
+func (bc *Bclient) APIDiff(cursor string) (*simplejson.Json, error) {
+	body, err := utilgo.GetContent(bc.APIDiffURL(cursor), 30)
+	if err != nil {
+		return nil, err
+	}
+	return simplejson.NewJson(body)
+}
+
+// Diff return the changes under root since cursor, created means ctime is not before since
+func (bc *Bclient) Diff(cursor string, since int64) (*DiffResult, error) {
+	js, err := bc.APIDiff(cursor)
+	if err != nil {
+		return nil, err
+	}
+	errMsg := js.Get("error_msg").MustString()
+	if errMsg != "" {
+		return nil, errors.New(errMsg)
+	}
+	var (
+		root    = path.Join("/", bc.root)
+		entries = js.Get("entries").MustMap()
+		r       = &DiffResult{
+			Cursor:  js.Get("cursor").MustString(),
+			HasMore: js.Get("has_more").MustBool(),
+			Reset:   js.Get("reset").MustBool(),
+		}
+	)
+	for p := range entries {
+		if p != root && !strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/") {
+			continue
+		}
+		item := js.Get("entries").Get(p)
+		c := Change{Type: ChangeModified, FileItem: newFileItem(item)}
+		if c.Path == "" {
+			c.Path = p
+		}
+		c.Path = bc.rel(c.Path)
+		if item.Get("isdelete").MustInt() != 0 {
+			c.Type = ChangeDeleted
+		} else if since > 0 && c.Ctime >= since {
+			c.Type = ChangeCreated
+		}
+		r.Changes = append(r.Changes, c)
+	}
+	sort.Slice(r.Changes, func(i, j int) bool {
+		return r.Changes[i].Path < r.Changes[j].Path
+	})
+	return r, nil
+}
+
+// Changes print the changes since cursor page by page and return the new cursor, quiet only returns the cursor
+func (bc *Bclient) Changes(cursor string, since int64, quiet bool) (string, error) {
+	var changes []Change
+	for {
+		r, err := bc.Diff(cursor, since)
+		if err != nil {
+			return cursor, err
+		}
+		if r.Reset && cursor != "" && !quiet {
+			Log.Print("游标已失效, 以下为全部文件")
+		}
+		if !quiet {
+			changes = append(changes, r.Changes...)
+		}
+		if r.Cursor != "" {
+			cursor = r.Cursor
+		}
+		if !r.HasMore {
+			break
+		}
+	}
+	if quiet {
+		return cursor, nil
+	}
+	rows := make([][]string, 0, len(changes))
+	for _, c := range changes {
+		rows = append(rows, append([]string{c.Type}, c.row()...))
+	}
+	if ok, err := bc.emit(changes, append([]string{"type"}, fileHeader...), rows); ok {
+		return cursor, err
+	}
+	b := strings.Builder{}
+	for _, c := range changes {
+		b.WriteString(fmt.Sprintf("%-10s%-22s%-10s%s\n", c.Type, utilgo.DateFormat(c.Mtime), utilgo.ByteFormat(c.Size), c.Path))
+	}
+	b.WriteString(fmt.Sprintf("共 %d 项变更", len(changes)))
+	Log.Print(b.String())
+	return cursor, nil
+}
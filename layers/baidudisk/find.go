@@ -0,0 +1,140 @@
+package baidudisk
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Filter match file items, zero value fields are ignored
+type Filter struct {
+	Name    string
+	Regexp  *regexp.Regexp
+	MinSize uint64
+	MaxSize uint64
+	After   int64
+	Before  int64
+	Type    string
+	Exts    []string
+	MD5     string
+}
+
+// Match report whether item matches all conditions
+func (f *Filter) Match(item FileItem) bool {
+	base := path.Base(item.Path)
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, base); !ok {
+			return false
+		}
+	}
+	if f.Regexp != nil && !f.Regexp.MatchString(base) {
+		return false
+	}
+	if (f.Type == "f" && item.IsDir) || (f.Type == "d" && !item.IsDir) {
+		return false
+	}
+	if f.MinSize > 0 && item.Size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && item.Size > f.MaxSize {
+		return false
+	}
+	if f.After > 0 && item.Mtime < f.After {
+		return false
+	}
+	if f.Before > 0 && item.Mtime > f.Before {
+		return false
+	}
+	if f.MD5 != "" && !strings.EqualFold(f.MD5, item.MD5) {
+		return false
+	}
+	if len(f.Exts) > 0 {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(base), "."))
+		for _, e := range f.Exts {
+			if ext == e {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// SearchTree walk the dir and return matched items sorted by path
+func (bc *Bclient) SearchTree(p string, filter *Filter, workers int) ([]FileItem, error) {
+	var items []FileItem
+	err := bc.Walk(p, -1, workers, func(dir string, list []FileItem) error {
+		for _, item := range list {
+			if filter.Match(item) {
+				item.Path = bc.rel(item.Path)
+				items = append(items, item)
+			}
+		}
+		return nil
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+	return items, err
+}
+
+// Find print or delete the matched items under dir
+func (bc *Bclient) Find(p string, filter *Filter, workers int, print0 bool, del bool) error {
+	items, err := bc.SearchTree(p, filter, workers)
+	if err != nil {
+		return err
+	}
+	if del {
+		var deleted []string
+		for _, item := range items {
+			if underAny(item.Path, deleted) {
+				continue
+			}
+			if err := bc.Rm(item.Path); err != nil {
+				return fmt.Errorf("%s: %v", item.Path, err)
+			}
+			deleted = append(deleted, item.Path)
+		}
+		return nil
+	}
+	return bc.PrintItems(items, print0)
+}
+
+// PrintItems print the paths of items, separated by NUL if print0
+func (bc *Bclient) PrintItems(items []FileItem, print0 bool) error {
+	if print0 {
+		w := Log.Writer()
+		for _, item := range items {
+			if _, err := fmt.Fprint(w, item.Path+"\x00"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if ok, err := bc.emit(items, fileHeader, fileRows(items)); ok {
+		return err
+	}
+	b := strings.Builder{}
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(item.Path)
+	}
+	if b.Len() > 0 {
+		Log.Print(b.String())
+	}
+	return nil
+}
+
+// underAny report whether p is under one of dirs
+func underAny(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
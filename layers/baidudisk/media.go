@@ -0,0 +1,110 @@
+package baidudisk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/suconghou/utilgo"
+)
+
+// StreamTypes are the transcoded HLS formats of PCS
+var StreamTypes = []string{"M3U8_AUTO_240", "M3U8_AUTO_360", "M3U8_AUTO_480", "M3U8_AUTO_720", "M3U8_AUTO_1080", "M3U8_320_240", "M3U8_480_224", "M3U8_480_360", "M3U8_640_480", "M3U8_854_480"}
+
+// DefaultStreamType is used when type is empty
+const DefaultStreamType = "M3U8_AUTO_480"
+
+// APIStreamingURL return the m3u8 url of video
+func (bc *Bclient) APIStreamingURL(file string, t string) string {
+	if t == "" {
+		t = DefaultStreamType
+	}
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&type=%s", bc.apiURL, "streaming", bc.token, bc.escPath(file), url.QueryEscape(t))
+}
+
+// Streaming check the video can be transcoded and return the m3u8 url
+func (bc *Bclient) Streaming(file string, t string) (string, error) {
+	if t != "" && !validStreamType(t) {
+		return "", fmt.Errorf("invalid type %s , should be one of %s", t, strings.Join(StreamTypes, " "))
+	}
+	url := bc.APIStreamingURL(file, t)
+	body, err := utilgo.GetContent(url, 30)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("#EXTM3U")) {
+		return "", apiError(body)
+	}
+	return url, nil
+}
+
+// the default and the max thumbnail size of the backend
+const (
+	thumbWidth  = 800
+	thumbHeight = 600
+	thumbMax    = 1600
+)
+
+// ThumbSize apply the default 800x600 to a zero width or height and check the limit of 1600x1600
+func ThumbSize(width int, height int) (int, int, error) {
+	if width == 0 {
+		width = thumbWidth
+	}
+	if height == 0 {
+		height = thumbHeight
+	}
+	if width < 1 || height < 1 || width > thumbMax || height > thumbMax {
+		return 0, 0, fmt.Errorf("invalid size %dx%d , should be at most %dx%d", width, height, thumbMax, thumbMax)
+	}
+	return width, height, nil
+}
+
+// APIThumbURL return the thumbnail url of image or video, width and height are at most 1600
+func (bc *Bclient) APIThumbURL(file string, width int, height int, quality int) string {
+	return fmt.Sprintf("%s?method=%s&access_token=%s&path=%s&width=%d&height=%d&quality=%d", bc.thumbURL, "generate", bc.token, bc.escPath(file), width, height, quality)
+}
+
+// Thumb save the thumbnail of file
+func (bc *Bclient) Thumb(file string, width int, height int, saveas string) error {
+	resp, err := utilgo.GetResp(bc.APIThumbURL(file, width, height, 100), 30)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		return apiError(body)
+	}
+	if err = ioutil.WriteFile(saveas, body, 0644); err != nil {
+		return err
+	}
+	Log.Printf("%s %dx%d\n已保存 %s", file, width, height, saveas)
+	return nil
+}
+
+// apiError return error_msg of the json response
+func apiError(body []byte) error {
+	if js, err := simplejson.NewJson(body); err == nil {
+		if errMsg := js.Get("error_msg").MustString(); errMsg != "" {
+			return errors.New(errMsg)
+		}
+	}
+	return fmt.Errorf("unexpected response %.200s", body)
+}
+
+func validStreamType(t string) bool {
+	for _, s := range StreamTypes {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package baidudisk
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+)
+
+// output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatTSV  = "tsv"
+)
+
+// FileItem is a file or dir entry of list/meta/search resp
+type FileItem struct {
+	Path  string `json:"path"`
+	Size  uint64 `json:"size"`
+	IsDir bool   `json:"isdir"`
+	Ctime int64  `json:"ctime"`
+	Mtime int64  `json:"mtime"`
+	FsID  int64  `json:"fs_id"`
+	MD5   string `json:"md5,omitempty"`
+}
+
+// fileDetail is the FileInfo record
+type fileDetail struct {
+	FileItem
+	Blocks []string `json:"block_list,omitempty"`
+	Link   string   `json:"link,omitempty"`
+}
+
+// diskInfo is the Info record
+type diskInfo struct {
+	Quota uint64 `json:"quota"`
+	Used  uint64 `json:"used"`
+}
+
+// TaskItem is a cloud download task
+type TaskItem struct {
+	ID           string `json:"task_id"`
+	Name         string `json:"task_name"`
+	Status       string `json:"status"`
+	StatusText   string `json:"status_text"`
+	CreateTime   int64  `json:"create_time"`
+	StartTime    int64  `json:"start_time,omitempty"`
+	FinishTime   int64  `json:"finish_time,omitempty"`
+	FileSize     uint64 `json:"file_size,omitempty"`
+	FinishedSize uint64 `json:"finished_size,omitempty"`
+	SourceURL    string `json:"source_url"`
+	SavePath     string `json:"save_path"`
+}
+
+var (
+	fileHeader = []string{"path", "size", "isdir", "ctime", "mtime", "fs_id", "md5"}
+	taskHeader = []string{"task_id", "task_name", "status", "create_time", "start_time", "finish_time", "file_size", "finished_size", "source_url", "save_path"}
+)
+
+// SetFormat set the cli output format, text json or tsv
+func (bc *Bclient) SetFormat(format string) error {
+	switch format {
+	case "", FormatText:
+		bc.format = FormatText
+	case FormatJSON, FormatTSV:
+		bc.format = format
+	default:
+		return fmt.Errorf("unknown format %s , should be text json or tsv", format)
+	}
+	return nil
+}
+
+// emit print v as json or rows as tsv, return false if format is text
+func (bc *Bclient) emit(v interface{}, header []string, rows [][]string) (bool, error) {
+	return bc.emitTo(Log, v, header, rows)
+}
+
+// emitTo is emit with the logger
+func (bc *Bclient) emitTo(out *log.Logger, v interface{}, header []string, rows [][]string) (bool, error) {
+	switch bc.format {
+	case FormatJSON:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return true, err
+		}
+		out.Print(string(bs))
+		return true, nil
+	case FormatTSV:
+		b := strings.Builder{}
+		b.WriteString(strings.Join(header, "\t"))
+		for _, row := range rows {
+			b.WriteString("\n")
+			for i, v := range row {
+				if i > 0 {
+					b.WriteString("\t")
+				}
+				b.WriteString(strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(v))
+			}
+		}
+		out.Print(b.String())
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f FileItem) row() []string {
+	return []string{f.Path, strconv.FormatUint(f.Size, 10), strconv.FormatBool(f.IsDir), strconv.FormatInt(f.Ctime, 10), strconv.FormatInt(f.Mtime, 10), strconv.FormatInt(f.FsID, 10), f.MD5}
+}
+
+func (t TaskItem) row() []string {
+	return []string{t.ID, t.Name, t.Status, strconv.FormatInt(t.CreateTime, 10), strconv.FormatInt(t.StartTime, 10), strconv.FormatInt(t.FinishTime, 10), strconv.FormatUint(t.FileSize, 10), strconv.FormatUint(t.FinishedSize, 10), t.SourceURL, t.SavePath}
+}
+
+func fileRows(items []FileItem) [][]string {
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, item.row())
+	}
+	return rows
+}
+
+// newFileItem parse one item of list/meta/search resp
+func newFileItem(item *simplejson.Json) FileItem {
+	f := FileItem{
+		Path:  item.Get("path").MustString(),
+		Size:  item.Get("size").MustUint64(),
+		IsDir: item.Get("isdir").MustInt() != 0,
+		Ctime: item.Get("ctime").MustInt64(),
+		Mtime: item.Get("mtime").MustInt64(),
+		FsID:  item.Get("fs_id").MustInt64(),
+		MD5:   item.Get("md5").MustString(),
+	}
+	if f.MD5 == "" {
+		if blocks, err := blockList(item); err == nil && len(blocks) == 1 {
+			f.MD5 = blocks[0]
+		}
+	}
+	return f
+}
+
+// newFileItems parse the list of list/search resp
+func newFileItems(js *simplejson.Json) []FileItem {
+	list := js.Get("list")
+	items := make([]FileItem, 0, len(list.MustArray()))
+	for i := range list.MustArray() {
+		items = append(items, newFileItem(list.GetIndex(i)))
+	}
+	return items
+}
+
+// blockList parse the block_list of meta resp
+func blockList(item *simplejson.Json) ([]string, error) {
+	blockstr := item.Get("block_list").MustString()
+	if blockstr == "" {
+		return nil, nil
+	}
+	blocks, err := simplejson.NewJson([]byte(blockstr))
+	if err != nil {
+		return nil, err
+	}
+	return blocks.MustStringArray(), nil
+}
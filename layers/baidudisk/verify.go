@@ -0,0 +1,181 @@
+package baidudisk
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/suconghou/utilgo"
+)
+
+// verify status
+const (
+	VerifyOK       = "OK"
+	VerifyMismatch = "MISMATCH"
+	VerifyMissing  = "MISSING"
+	VerifyUnknown  = "UNKNOWN"
+)
+
+const blockSize = 4 << 20
+
+// ErrVerify means some files are not the same
+var ErrVerify = errors.New("verify failed")
+
+// verifyResult is the Verify record
+type verifyResult struct {
+	Status     string `json:"status"`
+	Local      string `json:"local"`
+	Remote     string `json:"remote"`
+	LocalSize  int64  `json:"local_size"`
+	RemoteSize uint64 `json:"remote_size"`
+	LocalMD5   string `json:"local_md5"`
+	RemoteMD5  string `json:"remote_md5"`
+}
+
+// Verify compare size and md5 of local file or dir with the remote, return ErrVerify if any differs
+func (bc *Bclient) Verify(local string, p string, workers int) error {
+	info, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	var (
+		results []verifyResult
+		remote  = map[string]FileItem{}
+	)
+	if info.IsDir() {
+		err = bc.Walk(p, -1, workers, func(dir string, items []FileItem) error {
+			for _, item := range items {
+				item.Path = bc.rel(item.Path)
+				remote[item.Path] = item
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = filepath.Walk(local, func(file string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.Mode().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(local, file)
+			if err != nil {
+				return err
+			}
+			remotePath := path.Join(p, filepath.ToSlash(rel))
+			item, ok := remote[remotePath]
+			r, err := bc.verifyFile(file, fi, remotePath, item, ok)
+			results = append(results, r)
+			return err
+		})
+	} else {
+		var (
+			r    verifyResult
+			item *FileItem
+		)
+		item, err = bc.Stat(p)
+		if err == nil && item.IsDir {
+			p = path.Join(p, filepath.Base(local))
+			item, err = bc.Stat(p)
+		}
+		if err == nil {
+			item.Path = p
+			r, err = bc.verifyFile(local, info, p, *item, true)
+		} else {
+			// meta 失败视为远端不存在
+			r, err = bc.verifyFile(local, info, p, FileItem{}, false)
+		}
+		results = append(results, r)
+	}
+	if err != nil {
+		return err
+	}
+	failed := 0
+	rows := [][]string{}
+	for _, r := range results {
+		if r.Status != VerifyOK {
+			failed++
+		}
+		rows = append(rows, []string{r.Status, r.Local, r.Remote, strconv.FormatInt(r.LocalSize, 10), strconv.FormatUint(r.RemoteSize, 10), r.LocalMD5, r.RemoteMD5})
+	}
+	ok, err := bc.emit(results, []string{"status", "local", "remote", "local_size", "remote_size", "local_md5", "remote_md5"}, rows)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		b := strings.Builder{}
+		for _, r := range results {
+			b.WriteString(fmt.Sprintf("%-10s%-10s%s\n", r.Status, utilgo.ByteFormat(uint64(r.LocalSize)), r.Local))
+		}
+		b.WriteString(fmt.Sprintf("共 %d 个文件 %d 个不一致", len(results), failed))
+		Log.Print(b.String())
+	}
+	if failed > 0 {
+		return ErrVerify
+	}
+	return nil
+}
+
+// verifyFile compare one local file with the remote item
+func (bc *Bclient) verifyFile(file string, info os.FileInfo, p string, item FileItem, exist bool) (verifyResult, error) {
+	r := verifyResult{Local: file, Remote: p, LocalSize: info.Size(), RemoteSize: item.Size}
+	if !exist {
+		r.Status = VerifyMissing
+		return r, nil
+	}
+	if item.IsDir || uint64(info.Size()) != item.Size {
+		r.Status = VerifyMismatch
+		return r, nil
+	}
+	remoteHash, err := bc.contentHash(item)
+	if err != nil {
+		r.Status = VerifyUnknown
+		return r, nil
+	}
+	r.RemoteMD5 = remoteHash
+	f, err := os.Open(file)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+	if strings.Contains(remoteHash, ",") {
+		// 分片上传的文件只有分块哈希, 按4MB分块比较
+		r.LocalMD5, err = blockHash(f)
+		if err != nil {
+			return r, err
+		}
+		r.Status = utilgo.BoolString(strings.EqualFold(r.LocalMD5, remoteHash), VerifyOK, VerifyUnknown)
+		return r, nil
+	}
+	x, err := utilgo.GetFileHash(f, "md5")
+	if err != nil {
+		return r, err
+	}
+	r.LocalMD5 = hex.EncodeToString(x)
+	r.Status = utilgo.BoolString(strings.EqualFold(r.LocalMD5, remoteHash), VerifyOK, VerifyMismatch)
+	return r, nil
+}
+
+// blockHash return md5 of each 4MB block joined by comma
+func blockHash(f *os.File) (string, error) {
+	var hashes []string
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, f, blockSize)
+		if n > 0 {
+			hashes = append(hashes, hex.EncodeToString(h.Sum(nil)))
+		}
+		if err == io.EOF {
+			return strings.Join(hashes, ","), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package baidudisk
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/suconghou/utilgo"
+)
+
+// WalkFunc is called with each dir and its items, calls are serialized
+type WalkFunc func(dir string, items []FileItem) error
+
+// dirUsage is the Du record
+type dirUsage struct {
+	Path  string `json:"path"`
+	Size  uint64 `json:"size"`
+	Files int    `json:"files"`
+	Dirs  int    `json:"dirs"`
+}
+
+// treeNode is the Tree record
+type treeNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Size     uint64      `json:"size"`
+	IsDir    bool        `json:"isdir"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+// Walk list dir p and its sub dirs with a pool of workers, depth < 0 means no limit
+// a sub dir which can not be listed is reported and skipped, an error of p or fn stops the walk
+func (bc *Bclient) Walk(p string, depth int, workers int, fn WalkFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		werr  error
+		sem   = make(chan struct{}, workers)
+		top   = path.Join("/", p)
+		visit func(dir string, level int)
+	)
+	visit = func(dir string, level int) {
+		defer wg.Done()
+		sem <- struct{}{}
+		items, err := bc.List(dir)
+		<-sem
+		mu.Lock()
+		if werr == nil {
+			if err == nil {
+				werr = fn(dir, items)
+			} else if dir == top {
+				werr = fmt.Errorf("%s: %v", dir, err)
+			} else {
+				Warn.Printf("%s: %v", dir, err)
+			}
+		}
+		stop := werr != nil || err != nil
+		mu.Unlock()
+		if stop || (depth >= 0 && level >= depth) {
+			return
+		}
+		for _, item := range items {
+			if item.IsDir {
+				wg.Add(1)
+				go visit(bc.rel(item.Path), level+1)
+			}
+		}
+	}
+	wg.Add(1)
+	visit(top, 0)
+	wg.Wait()
+	return werr
+}
+
+// ListTree return items of all dirs under p, keyed by dir
+func (bc *Bclient) ListTree(p string, depth int, workers int) (map[string][]FileItem, error) {
+	tree := map[string][]FileItem{}
+	err := bc.Walk(p, depth, workers, func(dir string, items []FileItem) error {
+		tree[dir] = items
+		return nil
+	})
+	return tree, err
+}
+
+// Du print the recursive size and file count of sub dirs
+func (bc *Bclient) Du(p string, depth int, workers int) error {
+	p = path.Join("/", p)
+	tree, err := bc.ListTree(p, -1, workers)
+	if err != nil {
+		return err
+	}
+	var (
+		usages []dirUsage
+		sum    func(dir string, level int) dirUsage
+	)
+	sum = func(dir string, level int) dirUsage {
+		u := dirUsage{Path: dir}
+		for _, item := range tree[dir] {
+			if item.IsDir {
+				sub := sum(bc.rel(item.Path), level+1)
+				u.Size += sub.Size
+				u.Files += sub.Files
+				u.Dirs += sub.Dirs + 1
+			} else {
+				u.Size += item.Size
+				u.Files++
+			}
+		}
+		if level <= depth {
+			usages = append(usages, u)
+		}
+		return u
+	}
+	sum(p, 0)
+	sort.SliceStable(usages, func(i, j int) bool {
+		return usages[i].Size > usages[j].Size
+	})
+	rows := make([][]string, 0, len(usages))
+	for _, u := range usages {
+		rows = append(rows, []string{u.Path, strconv.FormatUint(u.Size, 10), strconv.Itoa(u.Files), strconv.Itoa(u.Dirs)})
+	}
+	if ok, err := bc.emit(usages, []string{"path", "size", "files", "dirs"}, rows); ok {
+		return err
+	}
+	b := strings.Builder{}
+	b.WriteString(name + bc.root + "  ➜  " + p)
+	for _, u := range usages {
+		b.WriteString(fmt.Sprintf("\n%-10s%-10d%s", utilgo.ByteFormat(u.Size), u.Files, u.Path))
+	}
+	Log.Print(b.String())
+	return nil
+}
+
+// Tree print the hierarchy of dir
+func (bc *Bclient) Tree(p string, depth int, workers int) error {
+	p = path.Join("/", p)
+	tree, err := bc.ListTree(p, depth, workers)
+	if err != nil {
+		return err
+	}
+	var (
+		dirs, files int
+		build       func(node *treeNode)
+	)
+	build = func(node *treeNode) {
+		items := tree[node.Path]
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Path < items[j].Path
+		})
+		for _, item := range items {
+			child := &treeNode{Name: path.Base(item.Path), Path: bc.rel(item.Path), Size: item.Size, IsDir: item.IsDir}
+			if item.IsDir {
+				dirs++
+				build(child)
+			} else {
+				files++
+			}
+			node.Children = append(node.Children, child)
+		}
+	}
+	root := &treeNode{Name: p, Path: p, IsDir: true}
+	build(root)
+	var (
+		rows [][]string
+		flat func(node *treeNode)
+	)
+	flat = func(node *treeNode) {
+		for _, child := range node.Children {
+			rows = append(rows, []string{child.Path, strconv.FormatUint(child.Size, 10), strconv.FormatBool(child.IsDir)})
+			flat(child)
+		}
+	}
+	flat(root)
+	if ok, err := bc.emit(root, []string{"path", "size", "isdir"}, rows); ok {
+		return err
+	}
+	b := strings.Builder{}
+	b.WriteString(name + bc.root + "  ➜  " + p)
+	var render func(node *treeNode, indent string)
+	render = func(node *treeNode, indent string) {
+		for i, child := range node.Children {
+			branch, next := "├── ", "│   "
+			if i == len(node.Children)-1 {
+				branch, next = "└── ", "    "
+			}
+			if child.IsDir {
+				b.WriteString("\n" + indent + branch + child.Name + "/")
+				render(child, indent+next)
+			} else {
+				b.WriteString("\n" + indent + branch + child.Name + "  " + utilgo.ByteFormat(child.Size))
+			}
+		}
+	}
+	render(root, "")
+	b.WriteString(fmt.Sprintf("\n\n%d directories, %d files", dirs, files))
+	Log.Print(b.String())
+	return nil
+}
+
+// rel return the path relative to root
+func (bc *Bclient) rel(p string) string {
+	return path.Join("/", strings.TrimPrefix(p, path.Join("/", bc.root)))
+}
+
+// Rel return the path of a listed item relative to root, as the other methods take
+func (bc *Bclient) Rel(p string) string {
+	return bc.rel(p)
+}
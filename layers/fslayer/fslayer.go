@@ -1,25 +1,63 @@
 package fslayer
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/suconghou/fastload/fastloader"
 	"github.com/suconghou/netdisk/config"
 	"github.com/suconghou/netdisk/layers/baidudisk"
+	"github.com/suconghou/netdisk/loader"
+	"github.com/suconghou/netdisk/util"
 	"github.com/suconghou/utilgo"
 )
 
-var client *baidudisk.Bclient
+var (
+	client   *baidudisk.Bclient
+	autosave = true
+)
 
 func init() {
 	client = baidudisk.NewClient(config.Cfg.Token, config.Cfg.Root)
+	client.SetCache(util.CacheDir(), util.CacheTTL())
+}
+
+// Unlock decrypt the token of an encrypted config, the passphrase may be asked
+func Unlock() error {
+	if !config.Locked() {
+		return nil
+	}
+	if err := config.Unlock(); err != nil {
+		return err
+	}
+	client.SetToken(config.Cfg.Token)
+	return nil
+}
+
+// SetCache use the ls and meta cache, false always requests the backend
+func SetCache(enable bool) {
+	if enable {
+		client.SetCache(util.CacheDir(), util.CacheTTL())
+	} else {
+		client.SetCache("", 0)
+	}
+}
+
+// SetFormat set the output format of read commands
+func SetFormat(format string) error {
+	return client.SetFormat(format)
 }
 
 // Pwd print current path
 func Pwd() error {
-	return client.Pwd(config.Cfg.Path)
+	return client.Pwd(absPath(""))
 }
 
 // GetInfo current backend info
@@ -29,75 +67,319 @@ func GetInfo() error {
 
 // ListDir list files and dirs
 func ListDir(filePath string, keep bool) error {
-	if filePath == "" {
-		filePath = config.Cfg.Path
+	filePath = absPath(filePath)
+	if keep && filePath != "/" {
+		item, err := client.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		if !item.IsDir {
+			return fmt.Errorf("%s is not a directory", filePath)
+		}
 	}
 	err := client.Ls(filePath)
 	if keep && err == nil && filePath != config.Cfg.Path {
 		config.Cfg.Path = filePath
-		config.Cfg.Save()
+		if autosave {
+			err = config.Cfg.Save()
+		}
 	}
 	return err
 }
 
+// SetLimiter limit the upload speed
+func SetLimiter(l *util.Limiter) {
+	client.SetLimiter(l)
+}
+
+// SetAutoSave set whether cd save the current dir to config file
+func SetAutoSave(save bool) {
+	autosave = save
+}
+
+// List return the items of dir
+func List(filePath string) ([]baidudisk.FileItem, error) {
+	return client.List(absPath(filePath))
+}
+
+// AbsPath resolve a remote path against the current dir
+func AbsPath(filePath string) string {
+	return absPath(filePath)
+}
+
+// LoadOption control the download threads chunk range and headers
+type LoadOption struct {
+	Thread  int32
+	Chunk   int64
+	Ranged  bool
+	Start   int64
+	End     int64 // 0 means to the end
+	Header  http.Header
+	Mirrors map[string]int
+	Size    int64             // expected length, 0 means unknown
+	Hashes  map[string]string // checked once finished
+	Pieces  *loader.Pieces
+	Limiter *util.Limiter // shared by all downloads of a queue
+	Quiet   bool          // do not print the progress
+}
+
+// DefaultLoadOption return the default 8 threads and 2MB chunk
+func DefaultLoadOption() *LoadOption {
+	return &LoadOption{Thread: 8, Chunk: 2097152, Header: http.Header{}}
+}
+
 // Get file form backend
-func Get(filePath string, saveas string, transport *http.Transport) error {
-	url := client.GetDownloadURL(filePath)
-	return WgetURL(url, saveas, transport)
+func Get(filePath string, saveas string, opt *LoadOption, transport *http.Transport) error {
+	url := client.GetDownloadURL(absPath(filePath))
+	return WgetURL(url, saveas, opt, transport)
+}
+
+// FileName return the file name of Content-Disposition or the final redirected url
+func FileName(url string, opt *LoadOption, transport *http.Transport) (string, error) {
+	return loader.FileName(url, opt.Header, transport)
 }
 
-// WgetURL download a url file
-func WgetURL(url string, saveas string, transport *http.Transport) error {
-	file, fstart, err := utilgo.GetContinue(saveas)
+// WgetURL download a url file, unfinished ranges are recorded in a .disk-part file
+func WgetURL(url string, saveas string, opt *LoadOption, transport *http.Transport) error {
+	var progress io.Writer = os.Stdout
+	if opt.Quiet {
+		progress = nil
+	}
+	return loader.New(opt.task(url, saveas, transport, progress, nil)).Run()
+}
+
+func (o *LoadOption) task(url string, saveas string, transport *http.Transport, progress io.Writer, hook func(loaded float64, speed float64, remain float64)) *loader.Task {
+	t := &loader.Task{
+		URL:       url,
+		Mirrors:   o.Mirrors,
+		Path:      saveas,
+		Thread:    int(o.Thread),
+		Chunk:     o.Chunk,
+		Ranged:    o.Ranged,
+		Start:     o.Start,
+		End:       o.End,
+		Header:    o.Header,
+		Transport: transport,
+		Progress:  progress,
+		Hook:      hook,
+		Size:      o.Size,
+		Hashes:    o.Hashes,
+		Pieces:    o.Pieces,
+	}
+	if o.Limiter != nil {
+		t.Limiter = o.Limiter
+	}
+	return t
+}
+
+// WgetMetalink download the files listed in a metalink file or url, saveas is only used for a single file
+func WgetMetalink(src string, saveas string, opt *LoadOption, transport *http.Transport) error {
+	var r io.ReadCloser
+	if utilgo.IsURL(src, true) {
+		c := &http.Client{}
+		if transport != nil {
+			c.Transport = transport
+		}
+		resp, err := c.Get(src)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("%s %s", resp.Status, src)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		r = f
+	}
+	files, err := loader.ParseMetalink(r)
+	r.Close()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	return fastloader.Load(file, map[string]int{url: 1}, 8, 1048576, fstart, 0, nil, transport, os.Stdout, nil)
+	if saveas != "" && len(files) > 1 {
+		return fmt.Errorf("%s has %d files, -o can not be used", src, len(files))
+	}
+	for _, f := range files {
+		name := saveas
+		if name == "" {
+			if name, err = loader.SafeName(f.Name); err != nil {
+				return err
+			}
+		}
+		o := *opt
+		o.Size, o.Pieces, o.Mirrors = f.Size, f.Pieces, f.Mirrors
+		o.Hashes = map[string]string{}
+		for t, v := range opt.Hashes {
+			o.Hashes[t] = v
+		}
+		for t, v := range f.Hashes {
+			o.Hashes[t] = v
+		}
+		if !opt.Quiet {
+			util.Log.Printf("%s <- %s (%d mirrors)", name, f.URLs[0], len(f.URLs))
+		}
+		if err = WgetURL(f.URLs[0], name, &o, transport); err != nil {
+			return fmt.Errorf("%s : %v", name, err)
+		}
+	}
+	return nil
 }
 
 // Play play a backend file
-func Play(filePath string, saveas string, stdout bool, transport *http.Transport) error {
-	url := client.GetDownloadURL(filePath)
-	return PlayURL(url, saveas, stdout, transport)
+func Play(filePath string, saveas string, stdout bool, opt *LoadOption, transport *http.Transport) error {
+	url := client.GetDownloadURL(absPath(filePath))
+	return PlayURL(url, saveas, stdout, opt, transport)
 }
 
 // PlayURL play a url media
-func PlayURL(url string, saveas string, stdout bool, transport *http.Transport) error {
-	var (
-		file   *os.File
-		err    error
-		fstart int64
-		player bool
-		writer io.Writer = os.Stderr
-		hook   func(loaded float64, speed float64, remain float64)
-	)
+func PlayURL(url string, saveas string, stdout bool, opt *LoadOption, transport *http.Transport) error {
 	if stdout {
-		file = os.Stdout
-	} else {
-		file, fstart, err = utilgo.GetContinue(saveas)
+		var start int64
+		if opt.Ranged {
+			start = opt.Start
+		}
+		if opt.Limiter == nil {
+			return fastloader.Load(os.Stdout, map[string]int{url: 1}, opt.Thread, opt.Chunk, start, opt.End, opt.Header, transport, os.Stderr, nil)
+		}
+		// 限速时经管道输出, 写入阻塞即可限制所有线程
+		r, w, err := os.Pipe()
 		if err != nil {
 			return err
 		}
-		hook = func(loaded float64, speed float64, remain float64) {
-			if loaded > 2 && !player {
-				utilgo.CallPlayer(saveas)
-				player = true
-			}
+		done := make(chan error, 1)
+		go func() {
+			_, err := util.LimitCopy(os.Stdout, r, opt.Limiter)
+			r.Close()
+			done <- err
+		}()
+		err = fastloader.Load(w, map[string]int{url: 1}, opt.Thread, opt.Chunk, start, opt.End, opt.Header, transport, os.Stderr, nil)
+		w.Close()
+		if cerr := <-done; err == nil {
+			err = cerr
 		}
+		return err
+	}
+	var (
+		ld      *loader.Loader
+		once    sync.Once
+		started bool
+		stop    func()
+		player  = make(chan *exec.Cmd, 1)
+		start   = config.Cfg.PlayerStart
+	)
+	if start <= 0 {
+		start = 2
+	}
+	hook := func(loaded float64, speed float64, remain float64) {
+		if loaded > start {
+			once.Do(func() {
+				started = true
+				cmd, closer := startPlayer(ld, saveas)
+				stop = closer
+				player <- cmd
+			})
+		}
+	}
+	ld = loader.New(opt.task(url, saveas, transport, os.Stderr, hook))
+	err := ld.Run()
+	// 等待进行中的 hook 完成
+	once.Do(func() {})
+	if started {
+		// 本地服务随进程退出, 等待播放器关闭
+		if cmd := <-player; cmd != nil {
+			fmt.Fprintln(os.Stderr, "\nwaiting for the player to exit")
+			cmd.Wait()
+		}
+		// 关闭本地服务, 在 shell 中不留下监听和打开的文件
+		if stop != nil {
+			stop()
+		}
+	}
+	return err
+}
+
+// startPlayer play the local server of the download, or the file if range is not supported
+// the returned func stops the local server, it is nil if there is none
+func startPlayer(ld *loader.Loader, saveas string) (*exec.Cmd, func()) {
+	addr, stop, err := ld.Serve()
+	if err != nil {
+		utilgo.CallPlayer(saveas)
+		return nil, nil
+	}
+	cmd, err := util.StartPlayer(config.Cfg.Player, addr, saveas)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if cmd == nil {
+		utilgo.CallPlayer(saveas)
+	}
+	return cmd, stop
+}
+
+// PlayStream play the HLS transcoded by the backend
+func PlayStream(filePath string, t string) error {
+	url, err := client.Streaming(absPath(filePath), t)
+	if err != nil {
+		return err
+	}
+	cmd, err := util.StartPlayer(config.Cfg.Player, url, url)
+	if err != nil {
+		return err
+	}
+	if cmd == nil {
+		return utilgo.CallPlayer(url)
+	}
+	return cmd.Wait()
+}
+
+// Thumb save the thumbnail of a backend image or video
+func Thumb(filePath string, width int, height int, saveas string) error {
+	return client.Thumb(absPath(filePath), width, height, saveas)
+}
+
+// Cat write a byte range of backend file to w, length < 0 means to the end, tail counts from the end
+func Cat(filePath string, length int64, tail bool, threads int, w io.Writer, transport *http.Transport) error {
+	filePath = absPath(filePath)
+	item, err := client.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if item.IsDir {
+		return fmt.Errorf("%s is a directory", filePath)
+	}
+	var (
+		size       = int64(item.Size)
+		start, end = int64(0), size - 1
+	)
+	if length >= 0 && length < size {
+		if tail {
+			start = size - length
+		} else {
+			end = length - 1
+		}
+	}
+	if end < start {
+		return nil
 	}
-	defer file.Close()
-	return fastloader.Load(file, map[string]int{url: 1}, 8, 1048576, fstart, 0, nil, transport, writer, hook)
+	r := util.NewRangeReader(client.GetDownloadURL(filePath), start, end, threads, 1048576, nil, transport)
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
 }
 
 // GetFileInfo print file info
 func GetFileInfo(filePath string, dlink bool) error {
-	return client.FileInfo(filePath, dlink)
+	return client.FileInfo(absPath(filePath), dlink)
 }
 
 // Put upload data to backend
 func Put(savePath string, overwrite bool, file *os.File) error {
-	return client.Put(savePath, overwrite, file)
+	return client.Put(absPath(savePath), overwrite, file)
 }
 
 // PutFile upload files to backend
@@ -110,24 +392,52 @@ func PutFileRapid(filePath string, savePath string, fileSize uint64, ondup strin
 
 }
 
+// Du print the usage of sub dirs
+func Du(filePath string, depth int, workers int) error {
+	return client.Du(absPath(filePath), depth, workers)
+}
+
+// Tree print the hierarchy of dir
+func Tree(filePath string, depth int, workers int) error {
+	return client.Tree(absPath(filePath), depth, workers)
+}
+
+// Find print or delete the matched items under dir
+func Find(filePath string, filter *baidudisk.Filter, workers int, print0 bool, del bool) error {
+	return client.Find(absPath(filePath), filter, workers, print0, del)
+}
+
+// Dedupe report duplicate files and delete or move the extra copies
+func Dedupe(filePath string, keep string, moveTo string, del bool, dryRun bool, workers int) error {
+	if moveTo != "" {
+		moveTo = absPath(moveTo)
+	}
+	return client.Dedupe(absPath(filePath), keep, moveTo, del, dryRun, workers)
+}
+
+// Verify compare local file or dir with the remote
+func Verify(local string, filePath string, workers int) error {
+	return client.Verify(local, absPath(filePath), workers)
+}
+
 // Mkdir create dir
 func Mkdir(path string) error {
-	return client.Mkdir(path)
+	return client.Mkdir(absPath(path))
 }
 
 // DeleteFile delete files
 func DeleteFile(fileName string) error {
-	return client.Rm(fileName)
+	return client.Rm(absPath(fileName))
 }
 
 // MoveFile move file
 func MoveFile(source string, target string) error {
-	return client.Mv(source, target)
+	return client.Mv(absPath(source), absPath(target))
 }
 
 // CopyFile copy files
 func CopyFile(source string, target string) error {
-	return client.Cp(source, target)
+	return client.Cp(absPath(source), absPath(target))
 }
 
 // SearchFile search files
@@ -147,7 +457,7 @@ func GetTaskList() error {
 
 // AddTask add a task
 func AddTask(savePath string, sourceURL string) error {
-	return client.TaskAdd(savePath, sourceURL)
+	return client.TaskAdd(absPath(savePath), sourceURL)
 }
 
 // RemoveTask remove a task
@@ -159,3 +469,42 @@ func RemoveTask(id string) error {
 func GetTaskInfo(ids string) error {
 	return client.TaskInfo(ids)
 }
+
+// absPath resolve p against the current remote dir, ~ means Root
+func absPath(p string) string {
+	switch {
+	case p == "":
+		return path.Join("/", config.Cfg.Path)
+	case p == "~" || strings.HasPrefix(p, "~/"):
+		return path.Join("/", p[1:])
+	case strings.HasPrefix(p, "/"):
+		return path.Clean(p)
+	default:
+		return path.Join("/", config.Cfg.Path, p)
+	}
+}
+
+// Changes print the changes since cursor, empty cursor means since the last stored one
+// init only stores the current cursor
+func Changes(cursor string, init bool) error {
+	since := config.Cfg.CursorTime
+	if cursor == "" {
+		cursor = config.Cfg.Cursor
+	} else if cursor != config.Cfg.Cursor {
+		since = 0
+	}
+	now := time.Now().Unix()
+	next, err := client.Changes(cursor, since, init)
+	if err != nil {
+		return err
+	}
+	if init {
+		util.Log.Printf("游标已保存 %s", next)
+	}
+	config.Cfg.Cursor = next
+	config.Cfg.CursorTime = now
+	if autosave {
+		return config.Cfg.Save()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package fslayer
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/suconghou/netdisk/config"
+	"github.com/suconghou/netdisk/index"
+	"github.com/suconghou/netdisk/layers/baidudisk"
+	"github.com/suconghou/netdisk/util"
+	"github.com/suconghou/utilgo"
+)
+
+// IndexBuild update the local index with the changes since the last build, full rebuild it from scratch
+func IndexBuild(full bool) error {
+	x, err := index.Open(index.DefaultPath())
+	if err != nil {
+		return err
+	}
+	defer x.Close()
+	var (
+		root    = path.Join("/", config.Cfg.Root)
+		m       = x.Meta()
+		cursor  = m.Cursor
+		reset   = full || cursor == "" || m.Root != root
+		changed int
+		deleted int
+	)
+	if reset {
+		cursor = ""
+	}
+	for {
+		r, err := client.Diff(cursor, 0)
+		if err != nil {
+			return err
+		}
+		for _, c := range r.Changes {
+			if c.Type == baidudisk.ChangeDeleted {
+				deleted++
+			} else {
+				changed++
+			}
+		}
+		// 游标失效时返回的是全量列表
+		if err = x.Apply(root, r.Cursor, reset || r.Reset, r.Changes); err != nil {
+			return err
+		}
+		reset = false
+		cursor = r.Cursor
+		if !r.HasMore {
+			break
+		}
+	}
+	files, dirs, size, err := x.Stats()
+	if err != nil {
+		return err
+	}
+	util.Log.Printf("更新 %d 项, 删除 %d 项\n已索引 %d 个文件 %d 个目录 %s", changed, deleted, files, dirs, utilgo.ByteFormat(size))
+	return nil
+}
+
+// IndexQuery print the indexed items under dir which match the filter, no request is sent
+func IndexQuery(dir string, filter *baidudisk.Filter, print0 bool) error {
+	x, err := index.Open(index.DefaultPath())
+	if err != nil {
+		return err
+	}
+	defer x.Close()
+	if m := x.Meta(); m.Cursor == "" {
+		return fmt.Errorf("index is empty, run disk index build first")
+	} else if m.Root != path.Join("/", config.Cfg.Root) {
+		return fmt.Errorf("index is built for root %s , run disk index build", m.Root)
+	}
+	items, err := x.Query(absPath(dir), filter)
+	if err != nil {
+		return err
+	}
+	return client.PrintItems(items, print0)
+}
@@ -0,0 +1,130 @@
+package fslayer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/suconghou/netdisk/config"
+	"github.com/suconghou/netdisk/layers/baidudisk"
+	"github.com/suconghou/netdisk/loader"
+	"github.com/suconghou/netdisk/util"
+)
+
+// mediaExts are the files put into the playlist
+var mediaExts = map[string]bool{
+	".mp4": true, ".mkv": true, ".avi": true, ".mov": true, ".flv": true, ".wmv": true, ".webm": true, ".m4v": true,
+	".ts": true, ".rmvb": true, ".rm": true, ".mpg": true, ".mpeg": true, ".3gp": true,
+	".mp3": true, ".flac": true, ".m4a": true, ".aac": true, ".wav": true, ".ogg": true, ".ape": true, ".wma": true, ".opus": true,
+}
+
+// PlayDir play the media files of a backend dir as a playlist, each entry is a local endpoint which proxies the download url
+func PlayDir(dir string, opt *LoadOption, transport *http.Transport) error {
+	dir = absPath(dir)
+	items, err := client.List(dir)
+	if err != nil {
+		return err
+	}
+	var files []baidudisk.FileItem
+	for _, item := range items {
+		if !item.IsDir && mediaExts[strings.ToLower(path.Ext(item.Path))] {
+			files = append(files, item)
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no media file in %s", dir)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return util.NaturalLess(path.Base(files[i].Path), path.Base(files[j].Path))
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	var (
+		base = "http://" + ln.Addr().String()
+		m3u  = strings.Builder{}
+		c    = &http.Client{}
+	)
+	if transport != nil {
+		c.Transport = transport
+	}
+	m3u.WriteString("#EXTM3U\n")
+	for i, f := range files {
+		name := path.Base(f.Path)
+		m3u.WriteString(fmt.Sprintf("#EXTINF:-1,%s\n%s/play/%d/%s\n", name, base, i, url.PathEscape(name)))
+		util.Log.Printf("%3d %s", i+1, name)
+	}
+	name, err := loader.SafeName(path.Base(dir))
+	if err != nil {
+		name = "root"
+	}
+	playlist := filepath.Join(os.TempDir(), "disk-"+name+".m3u")
+	if err = ioutil.WriteFile(playlist, []byte(m3u.String()), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(playlist)
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/playlist.m3u" {
+			w.Header().Set("Content-Type", "audio/x-mpegurl")
+			io.WriteString(w, m3u.String())
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/play/"), "/", 2)
+		i, err := strconv.Atoi(parts[0])
+		if !strings.HasPrefix(r.URL.Path, "/play/") || err != nil || i < 0 || i >= len(files) {
+			http.NotFound(w, r)
+			return
+		}
+		streamFile(w, r, c, client.GetDownloadURL(client.Rel(files[i].Path)), opt)
+	}))
+	util.Log.Printf("播放列表 %s\n%s/playlist.m3u", playlist, base)
+	cmd, err := util.StartPlayer(config.Cfg.Player, playlist, playlist)
+	if err != nil {
+		return err
+	}
+	if cmd == nil {
+		// 没有可用的播放器, 持续服务直到 Ctrl+C, 在 shell 中则回到提示符
+		util.Log.Printf("no player found, open %s/playlist.m3u in a player, press Ctrl+C to stop", base)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sig)
+		<-sig
+		return nil
+	}
+	return cmd.Wait()
+}
+
+// streamFile proxy the download url with the range of the player
+func streamFile(w http.ResponseWriter, r *http.Request, c *http.Client, target string, opt *LoadOption) {
+	req, err := http.NewRequest(r.Method, target, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for k, v := range opt.Header {
+		req.Header[k] = v
+	}
+	util.CopyHeader(r.Header, req.Header, []string{"Range", "If-Range"})
+	resp, err := c.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	util.CopyHeader(resp.Header, w.Header(), util.ExposeHeaders)
+	w.WriteHeader(resp.StatusCode)
+	util.LimitCopy(w, resp.Body, opt.Limiter)
+}
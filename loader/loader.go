@@ -0,0 +1,540 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/suconghou/utilgo"
+)
+
+const (
+	maxRetry  = 5
+	bufSize   = 32 * 1024
+	saveEvery = time.Second
+)
+
+// retryDelay is multiplied by the retry count before a failed range is fetched again
+var retryDelay = time.Second
+
+// Task is one file download
+type Task struct {
+	URL       string
+	Mirrors   map[string]int // other urls of the same file and their weights
+	Path      string
+	Thread    int
+	Chunk     int64
+	Ranged    bool
+	Start     int64
+	End       int64 // inclusive, 0 means to the end
+	Header    http.Header
+	Transport *http.Transport
+	Progress  io.Writer
+	Hook      func(loaded float64, speed float64, remain float64)
+	Size      int64             // expected length, 0 means unknown
+	Hashes    map[string]string // whole file hashes like sha-256 to check once finished
+	Pieces    *Pieces           // piece hashes, corrupted pieces are fetched again
+	Limiter   Limiter           // shared bandwidth budget, nil means unlimited
+}
+
+// Limiter block until n bytes are allowed to transfer
+type Limiter interface {
+	Wait(n int)
+}
+
+// Loader download a task with a persisted chunk map
+type Loader struct {
+	task      *Task
+	client    *http.Client
+	file      *os.File
+	state     *State
+	statePath string
+	mirrors   *mirrorSet
+	mu        sync.Mutex
+	saved     time.Time
+	finished  bool // the chunk map is removed, ranges served later are not recorded
+	loaded    int64
+	total     int64
+	startTime time.Time
+}
+
+type job struct {
+	start int64
+	end   int64
+	retry int
+}
+
+// New return a Loader
+func New(task *Task) *Loader {
+	client := &http.Client{}
+	if task.Transport != nil {
+		client.Transport = task.Transport
+	}
+	if task.Thread < 1 {
+		task.Thread = 1
+	}
+	if task.Chunk < 1 {
+		task.Chunk = 1048576
+	}
+	if task.Header == nil {
+		task.Header = http.Header{}
+	}
+	return &Loader{task: task, client: client, statePath: task.Path + StateSuffix}
+}
+
+// Run download the missing ranges, the chunk map is removed once finished
+func (l *Loader) Run() error {
+	size, etag, lastModified, ranged, err := l.probe(l.task.URL)
+	if err != nil {
+		return err
+	}
+	if l.task.Size > 0 && size >= 0 && size != l.task.Size {
+		return fmt.Errorf("%s length %d differs from %d", l.task.URL, size, l.task.Size)
+	}
+	if size < 0 || !ranged {
+		if err = l.stream(); err != nil {
+			return err
+		}
+		return l.verifyFile()
+	}
+	l.checkMirrors(size)
+	if err = l.prepare(size, etag, lastModified); err != nil {
+		return err
+	}
+	defer l.file.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	l.total = l.state.End - l.state.Start + 1
+	l.startTime = time.Now()
+	go l.report(stop)
+	for round := 0; ; round++ {
+		if err = l.download(); err != nil {
+			return err
+		}
+		bad, err := l.verifyPieces()
+		if err != nil {
+			return err
+		}
+		if len(bad) == 0 {
+			break
+		}
+		if round >= maxRetry {
+			return fmt.Errorf("%d pieces still corrupted after %d rounds", len(bad), round+1)
+		}
+		// 分片校验失败的范围重新下载
+		l.mu.Lock()
+		for _, r := range bad {
+			l.state.remove(r[0], r[1])
+		}
+		err = l.state.save(l.statePath)
+		l.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if l.task.Progress != nil {
+			fmt.Fprintf(l.task.Progress, "\n%d pieces corrupted, fetching again\n", len(bad))
+		}
+	}
+	l.progress()
+	if l.task.Progress != nil {
+		fmt.Fprintln(l.task.Progress)
+	}
+	if err = l.verifyFile(); err != nil {
+		// 整个文件校验失败时无法定位坏的部分, 丢弃已下载的数据
+		l.mu.Lock()
+		l.state.Done = nil
+		serr := l.state.save(l.statePath)
+		l.mu.Unlock()
+		if serr == nil {
+			serr = l.file.Truncate(0)
+		}
+		if serr != nil {
+			return fmt.Errorf("%v, reset %s failed: %v", err, l.statePath, serr)
+		}
+		return fmt.Errorf("%v, the downloaded data is discarded, run again to download it from the start", err)
+	}
+	l.mu.Lock()
+	l.finished = true
+	l.mu.Unlock()
+	return os.Remove(l.statePath)
+}
+
+// download fetch the missing ranges with the workers and save the chunk map
+func (l *Loader) download() error {
+	var (
+		s       = l.state
+		jobs    = make(chan job, l.task.Thread)
+		results = make(chan error)
+		pending = 0
+		failed  error
+		queue   []job
+	)
+	atomic.StoreInt64(&l.loaded, s.completed(s.Start, s.End))
+	for _, r := range s.missing(s.Start, s.End) {
+		for start := r[0]; start <= r[1]; start += l.task.Chunk {
+			end := start + l.task.Chunk - 1
+			if end > r[1] {
+				end = r[1]
+			}
+			queue = append(queue, job{start: start, end: end})
+		}
+	}
+	for i := 0; i < l.task.Thread; i++ {
+		go func() {
+			for j := range jobs {
+				results <- l.fetch(j)
+			}
+		}()
+	}
+	for len(queue) > 0 || pending > 0 {
+		var (
+			next job
+			in   chan job
+		)
+		if len(queue) > 0 && failed == nil {
+			next, in = queue[0], jobs
+		} else if pending == 0 {
+			break
+		}
+		select {
+		case in <- next:
+			queue = queue[1:]
+			pending++
+		case err := <-results:
+			pending--
+			if re, ok := err.(*retryError); ok && re.job.retry <= maxRetry {
+				queue = append(queue, re.job)
+			} else if err != nil && failed == nil {
+				failed = err
+			}
+		}
+	}
+	close(jobs)
+	l.mu.Lock()
+	err := s.save(l.statePath)
+	l.mu.Unlock()
+	if failed != nil {
+		return failed
+	}
+	if err != nil {
+		return err
+	}
+	if !s.covered(s.Start, s.End) {
+		return fmt.Errorf("download not completed, run again to continue")
+	}
+	return nil
+}
+
+// Completed report whether remote range [start,end] is downloaded
+func (l *Loader) Completed(start int64, end int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state != nil && l.state.covered(start, end)
+}
+
+type retryError struct {
+	job job
+	err error
+}
+
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
+
+// fetch download one job, the written part is marked done and the rest is retried
+func (l *Loader) fetch(j job) error {
+	var (
+		m   = l.mirrors.pick()
+		t   = time.Now()
+		pos int64
+		err error
+	)
+	pos, err = l.get(m.url, j.start, j.end)
+	l.mirrors.report(m, pos-j.start, time.Since(t), err)
+	l.mu.Lock()
+	l.state.add(j.start, pos-1)
+	if time.Since(l.saved) > saveEvery {
+		if serr := l.state.save(l.statePath); serr != nil && err == nil {
+			err = serr
+		}
+		l.saved = time.Now()
+	}
+	l.mu.Unlock()
+	if err != nil && pos <= j.end {
+		time.Sleep(retryDelay * time.Duration(j.retry+1))
+		return &retryError{job: job{start: pos, end: j.end, retry: j.retry + 1}, err: err}
+	}
+	return err
+}
+
+// get write [start,end] to file and return the next offset to write
+func (l *Loader) get(url string, start int64, end int64) (int64, error) {
+	req, err := l.request(url, start, end)
+	if err != nil {
+		return start, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return start, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return start, fmt.Errorf("%s : range %d-%d not supported", resp.Status, start, end)
+	}
+	var (
+		pos = start
+		buf = make([]byte, bufSize)
+	)
+	for pos <= end {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if l.task.Limiter != nil {
+				l.task.Limiter.Wait(n)
+			}
+			if int64(n) > end-pos+1 {
+				n = int(end - pos + 1)
+			}
+			if _, werr := l.file.WriteAt(buf[:n], pos-l.state.Base); werr != nil {
+				return pos, werr
+			}
+			pos += int64(n)
+			atomic.AddInt64(&l.loaded, int64(n))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pos, err
+		}
+	}
+	if pos <= end {
+		return pos, io.ErrUnexpectedEOF
+	}
+	return pos, nil
+}
+
+func (l *Loader) request(url string, start int64, end int64) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range l.task.Header {
+		req.Header[k] = v
+	}
+	if end >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+	return req, nil
+}
+
+// probe return the size etag last-modified and whether range is supported, size is -1 if unknown
+func (l *Loader) probe(url string) (int64, string, string, bool, error) {
+	req, err := l.request(url, 0, 0)
+	if err != nil {
+		return 0, "", "", false, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, "", "", false, err
+	}
+	defer resp.Body.Close()
+	var (
+		etag         = resp.Header.Get("ETag")
+		lastModified = resp.Header.Get("Last-Modified")
+	)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		cr := resp.Header.Get("Content-Range")
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			if size, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil {
+				return size, etag, lastModified, true, nil
+			}
+		}
+		return -1, etag, lastModified, false, nil
+	case http.StatusOK:
+		return resp.ContentLength, etag, lastModified, false, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, etag, lastModified, true, nil
+	}
+	return 0, "", "", false, fmt.Errorf("%s %s", resp.Status, url)
+}
+
+// checkMirrors add the primary url and the mirrors which serve the same length
+func (l *Loader) checkMirrors(size int64) {
+	l.mirrors = newMirrorSet()
+	l.mirrors.add(l.task.URL, l.task.Mirrors[l.task.URL])
+	urls := make([]string, 0, len(l.task.Mirrors))
+	for url := range l.task.Mirrors {
+		if url != l.task.URL {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		n, _, _, ranged, err := l.probe(url)
+		if err == nil && !ranged {
+			err = fmt.Errorf("range not supported")
+		} else if err == nil && n != size {
+			err = fmt.Errorf("length %d differs from %d", n, size)
+		}
+		if err != nil {
+			if l.task.Progress != nil {
+				fmt.Fprintf(l.task.Progress, "skip mirror %s : %v\n", url, err)
+			}
+			continue
+		}
+		l.mirrors.add(url, l.task.Mirrors[url])
+	}
+}
+
+// prepare load or create the chunk map and open the file
+func (l *Loader) prepare(size int64, etag string, lastModified string) error {
+	state, err := loadState(l.statePath)
+	if err != nil {
+		return err
+	}
+	if state != nil && !state.same(size, etag, lastModified) {
+		return fmt.Errorf("remote content changed since last download, remove %s and %s to start over", l.task.Path, l.statePath)
+	}
+	var (
+		fsize    int64
+		truncate int64 = -1
+	)
+	if info, err := os.Stat(l.task.Path); err == nil {
+		fsize = info.Size()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if state == nil {
+		state = &State{URL: l.task.URL, Size: size, ETag: etag, LastModified: lastModified, End: size - 1}
+		if l.task.End > 0 && l.task.End < size-1 {
+			state.End = l.task.End
+		}
+		if l.task.Ranged {
+			// 指定范围时文件从范围起点开始存放, 已有数据则从文件末尾继续
+			state.Start = l.task.Start
+			if fsize > state.Start {
+				state.Start = fsize
+			}
+			state.Base = state.Start - fsize
+		} else if fsize > 0 {
+			// 没有分块记录的旧文件无法确认内容, 重新下载
+			if l.task.Progress != nil {
+				fmt.Fprintf(l.task.Progress, "%s has no %s, download it again\n", l.task.Path, StateSuffix)
+			}
+			truncate = 0
+		}
+	} else {
+		state.URL = l.task.URL
+	}
+	if state.Start > state.End {
+		state.End = state.Start - 1
+	}
+	// 比远程文件长的旧数据截掉
+	if length := state.End - state.Base + 1; truncate < 0 && fsize > length {
+		truncate = length
+	}
+	file, err := os.OpenFile(l.task.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if truncate >= 0 {
+		if err = file.Truncate(truncate); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	l.file, l.state = file, state
+	return nil
+}
+
+// stream download the whole body when range is not supported
+func (l *Loader) stream() error {
+	if _, err := os.Stat(l.statePath); err == nil {
+		return fmt.Errorf("%s can not be continued because range is not supported now", l.task.Path)
+	}
+	req, err := l.request(l.task.URL, 0, -1)
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s", resp.Status, l.task.URL)
+	}
+	file, err := os.Create(l.task.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	l.total, l.startTime = resp.ContentLength, time.Now()
+	stop := make(chan struct{})
+	defer close(stop)
+	go l.report(stop)
+	_, err = io.Copy(file, &counter{r: resp.Body, n: &l.loaded, limiter: l.task.Limiter})
+	return err
+}
+
+type counter struct {
+	r       io.Reader
+	n       *int64
+	limiter Limiter
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.limiter != nil {
+		c.limiter.Wait(n)
+	}
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+func (l *Loader) report(stop chan struct{}) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			l.progress()
+		}
+	}
+}
+
+// progress print the progress and call the hook
+func (l *Loader) progress() {
+	var (
+		loaded   = atomic.LoadInt64(&l.loaded)
+		duration = time.Since(l.startTime).Seconds()
+		percent  float64
+		speed    float64
+		remain   float64
+	)
+	if duration > 0 {
+		speed = float64(loaded) / duration
+	}
+	if l.total > 0 {
+		percent = float64(loaded) / float64(l.total) * 100
+		if speed > 0 {
+			remain = float64(l.total-loaded) / speed
+		}
+	}
+	if l.task.Progress != nil {
+		fmt.Fprintf(l.task.Progress, "\r\033[2K\r%.1f%% %s/%s %s/s %.0fs", percent, utilgo.ByteFormat(uint64(loaded)), utilgo.ByteFormat(uint64(l.total)), utilgo.ByteFormat(uint64(speed)), remain)
+	}
+	if l.task.Hook != nil {
+		l.task.Hook(percent, speed, remain)
+	}
+}
@@ -0,0 +1,159 @@
+package loader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rangeServer serve data with range support, ranges from failFrom fail while broken is set
+type rangeServer struct {
+	data     []byte
+	failFrom int64
+	broken   int32
+	served   int64
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start, end, ok := parseRange(r.Header.Get("Range"), int64(len(s.data)))
+	if !ok {
+		start, end = 0, int64(len(s.data))-1
+	}
+	if atomic.LoadInt32(&s.broken) == 1 && end >= s.failFrom {
+		http.Error(w, "broken", http.StatusInternalServerError)
+		return
+	}
+	atomic.AddInt64(&s.served, end-start+1)
+	http.ServeContent(w, r, "data", time.Time{}, bytes.NewReader(s.data))
+}
+
+func newRangeServer(t *testing.T, size int) (*rangeServer, *httptest.Server) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	s := &rangeServer{data: data, failFrom: int64(size / 2)}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func init() {
+	retryDelay = time.Millisecond
+}
+
+func TestResume(t *testing.T) {
+	s, ts := newRangeServer(t, 64*1024)
+	file := filepath.Join(t.TempDir(), "data")
+	task := func() *Task {
+		return &Task{URL: ts.URL, Path: file, Thread: 2, Chunk: 4096}
+	}
+	atomic.StoreInt32(&s.broken, 1)
+	if err := New(task()).Run(); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+	state, err := loadState(file + StateSuffix)
+	if err != nil || state == nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+	done := state.completed(0, int64(len(s.data))-1)
+	if done == 0 || done >= int64(len(s.data)) {
+		t.Fatalf("interrupted download completed %d bytes", done)
+	}
+	atomic.StoreInt32(&s.broken, 0)
+	atomic.StoreInt64(&s.served, 0)
+	if err = New(task()).Run(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, s.data) {
+		t.Fatal("resumed file differs")
+	}
+	if _, err = os.Stat(file + StateSuffix); !os.IsNotExist(err) {
+		t.Fatalf("state not removed: %v", err)
+	}
+	// 只有探测请求的 1 字节和缺失部分被重新下载
+	if served := atomic.LoadInt64(&s.served); served > int64(len(s.data))-done+1 {
+		t.Fatalf("resumed download fetched %d bytes, %d were done", served, done)
+	}
+}
+
+func TestStaleFile(t *testing.T) {
+	for _, extra := range []int{-100, 0, 100} {
+		s, ts := newRangeServer(t, 16*1024)
+		file := filepath.Join(t.TempDir(), "data")
+		stale := bytes.Repeat([]byte{'x'}, len(s.data)+extra)
+		if err := ioutil.WriteFile(file, stale, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := New(&Task{URL: ts.URL, Path: file, Chunk: 4096}).Run(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, s.data) {
+			t.Fatalf("file without %s of %d extra bytes is not downloaded again", StateSuffix, extra)
+		}
+	}
+}
+
+func TestHashMismatch(t *testing.T) {
+	s, ts := newRangeServer(t, 16*1024)
+	file := filepath.Join(t.TempDir(), "data")
+	task := &Task{URL: ts.URL, Path: file, Chunk: 4096, Hashes: map[string]string{"sha-256": "00"}}
+	if err := New(task).Run(); err == nil {
+		t.Fatal("hash mismatch not reported")
+	}
+	state, err := loadState(file + StateSuffix)
+	if err != nil || state == nil {
+		t.Fatalf("state not kept: %v", err)
+	}
+	if n := state.completed(0, int64(len(s.data))-1); n != 0 {
+		t.Fatalf("%d bytes still marked done after hash mismatch", n)
+	}
+}
+
+func TestServeWriteBack(t *testing.T) {
+	s, ts := newRangeServer(t, 64*1024)
+	file := filepath.Join(t.TempDir(), "data")
+	atomic.StoreInt32(&s.broken, 1)
+	ld := New(&Task{URL: ts.URL, Path: file, Chunk: 4096})
+	if err := ld.Run(); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+	atomic.StoreInt32(&s.broken, 0)
+	addr, stop, err := ld.Serve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !bytes.Equal(got, s.data) {
+		t.Fatalf("served data differs: %v", err)
+	}
+	if !ld.Completed(0, int64(len(s.data))-1) {
+		t.Fatal("served ranges are not recorded")
+	}
+	saved, _ := ioutil.ReadFile(file)
+	if !bytes.Equal(saved, s.data) {
+		t.Fatal("served ranges are not written back")
+	}
+	stop()
+	if _, err = http.Get(addr); err == nil {
+		t.Fatal("server still running after stop")
+	}
+}
@@ -0,0 +1,95 @@
+package loader
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MetaFile is one file described by a metalink
+type MetaFile struct {
+	Name    string
+	Size    int64
+	Hashes  map[string]string
+	Pieces  *Pieces
+	Mirrors map[string]int // url and weight
+	URLs    []string       // the first one has the highest priority
+}
+
+type metalinkXML struct {
+	Files []struct {
+		Name   string `xml:"name,attr"`
+		Size   int64  `xml:"size"`
+		Hashes []struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"hash"`
+		Pieces []struct {
+			Type   string   `xml:"type,attr"`
+			Length int64    `xml:"length,attr"`
+			Hashes []string `xml:"hash"`
+		} `xml:"pieces"`
+		URLs []struct {
+			Priority int    `xml:"priority,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"url"`
+	} `xml:"file"`
+}
+
+// ParseMetalink parse a metalink v4 document, unsupported hash types are ignored
+func ParseMetalink(r io.Reader) ([]MetaFile, error) {
+	var m metalinkXML
+	if err := xml.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid metalink: %v", err)
+	}
+	var files []MetaFile
+	for _, f := range m.Files {
+		file := MetaFile{Name: f.Name, Size: f.Size, Hashes: map[string]string{}, Mirrors: map[string]int{}}
+		for _, h := range f.Hashes {
+			if _, err := NewHash(h.Type); err == nil {
+				file.Hashes[h.Type] = strings.TrimSpace(h.Value)
+			}
+		}
+		for _, p := range f.Pieces {
+			if _, err := NewHash(p.Type); err == nil && p.Length > 0 && len(p.Hashes) > 0 {
+				pieces := &Pieces{Type: p.Type, Length: p.Length}
+				for _, h := range p.Hashes {
+					pieces.Hashes = append(pieces.Hashes, strings.TrimSpace(h))
+				}
+				file.Pieces = pieces
+				break
+			}
+		}
+		best := 0
+		for _, u := range f.URLs {
+			url := strings.TrimSpace(u.Value)
+			if url == "" {
+				continue
+			}
+			// priority 1 最高, 换算为权重
+			weight := 1
+			if u.Priority > 0 && u.Priority < 100 {
+				weight = 100 / u.Priority
+			}
+			if _, ok := file.Mirrors[url]; ok {
+				continue
+			}
+			file.Mirrors[url] = weight
+			if weight > best {
+				file.URLs = append([]string{url}, file.URLs...)
+				best = weight
+			} else {
+				file.URLs = append(file.URLs, url)
+			}
+		}
+		if file.Name == "" || len(file.URLs) == 0 {
+			return nil, fmt.Errorf("invalid metalink: file %s has no name or url", f.Name)
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("invalid metalink: no file")
+	}
+	return files, nil
+}
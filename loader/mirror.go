@@ -0,0 +1,116 @@
+package loader
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	maxFails  = 3
+	slowRatio = 0.25
+)
+
+// mirror is one source of the file
+type mirror struct {
+	url      string
+	weight   int
+	factor   float64 // demoted when failed or slow
+	fails    int
+	speed    float64 // bytes per second of recent chunks
+	disabled bool
+}
+
+type mirrorSet struct {
+	mu      sync.Mutex
+	mirrors []*mirror
+}
+
+func newMirrorSet() *mirrorSet {
+	return &mirrorSet{}
+}
+
+func (s *mirrorSet) add(url string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	s.mirrors = append(s.mirrors, &mirror{url: url, weight: weight, factor: 1})
+}
+
+// pick choose a mirror randomly by weight
+func (s *mirrorSet) pick() *mirror {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		total float64
+		alive []*mirror
+	)
+	for _, m := range s.mirrors {
+		if !m.disabled {
+			alive = append(alive, m)
+			total += float64(m.weight) * m.factor
+		}
+	}
+	if len(alive) == 0 {
+		return s.mirrors[0]
+	}
+	n := rand.Float64() * total
+	for _, m := range alive {
+		n -= float64(m.weight) * m.factor
+		if n < 0 {
+			return m
+		}
+	}
+	return alive[len(alive)-1]
+}
+
+// report demote the mirror which failed or is much slower than others
+func (s *mirrorSet) report(m *mirror, n int64, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		m.fails++
+		m.factor /= 2
+		if m.fails >= maxFails && s.alive() > 1 {
+			m.disabled = true
+		}
+		return
+	}
+	m.fails = 0
+	if d <= 0 || n <= 0 {
+		return
+	}
+	speed := float64(n) / d.Seconds()
+	if m.speed == 0 {
+		m.speed = speed
+	} else {
+		m.speed = m.speed*0.7 + speed*0.3
+	}
+	var best float64
+	for _, o := range s.mirrors {
+		if !o.disabled && o.speed > best {
+			best = o.speed
+		}
+	}
+	if m.speed < best*slowRatio {
+		m.factor /= 2
+	} else if m.factor < 1 {
+		m.factor *= 1.25
+		if m.factor > 1 {
+			m.factor = 1
+		}
+	}
+	if m.factor < 0.01 {
+		m.factor = 0.01
+	}
+}
+
+func (s *mirrorSet) alive() int {
+	n := 0
+	for _, m := range s.mirrors {
+		if !m.disabled {
+			n++
+		}
+	}
+	return n
+}
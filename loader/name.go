@@ -0,0 +1,109 @@
+package loader
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultName = "index.html"
+	maxNameLen  = 200
+)
+
+var dispositionRe = regexp.MustCompile(`(?i)filename\s*=\s*"?([^";]+)`)
+
+// FileName probe url and return the file name of Content-Disposition or the final redirected url
+func FileName(url string, header http.Header, transport *http.Transport) (string, error) {
+	l := New(&Task{URL: url, Header: header, Transport: transport})
+	req, err := l.request(url, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return "", fmt.Errorf("%s %s", resp.Status, url)
+	}
+	name := dispositionName(resp.Header.Get("Content-Disposition"))
+	if name == "" {
+		// 跟随跳转后的地址
+		name = path.Base(resp.Request.URL.Path)
+	}
+	if name, err = SafeName(name); err != nil {
+		return defaultName, nil
+	}
+	return name, nil
+}
+
+// dispositionName return the filename of Content-Disposition, filename* of RFC 5987 is preferred
+func dispositionName(v string) string {
+	if v == "" {
+		return ""
+	}
+	if _, params, err := mime.ParseMediaType(v); err == nil {
+		return params["filename"]
+	}
+	// 不规范的响应头, 比如未加引号的非 ASCII 文件名
+	if m := dispositionRe.FindStringSubmatch(v); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// SafeName return a file name without dir, control or reserved characters, which must not escape the current dir
+func SafeName(name string) (string, error) {
+	base := filepath.Base(filepath.Clean("/" + strings.Replace(name, "\\", "/", -1)))
+	base = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, base)
+	base = strings.Trim(base, " .")
+	if len(base) > maxNameLen {
+		ext := path.Ext(base)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		stem := base[:maxNameLen-len(ext)]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+		base = stem + ext
+	}
+	if base == "" || base == "_" {
+		return "", fmt.Errorf("invalid file name %s", name)
+	}
+	return base, nil
+}
+
+// Exists report whether the file is there and not a unfinished download
+func Exists(name string) bool {
+	if _, err := os.Stat(name); err != nil {
+		return false
+	}
+	_, err := os.Stat(name + StateSuffix)
+	return os.IsNotExist(err)
+}
+
+// FreeName return name or name.1.ext name.2.ext ... which is not taken
+func FreeName(name string, taken func(string) bool) string {
+	var (
+		ext  = path.Ext(name)
+		stem = strings.TrimSuffix(name, ext)
+	)
+	for i := 1; taken(name); i++ {
+		name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+	}
+	return name
+}
@@ -0,0 +1,102 @@
+package loader
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDispositionName(t *testing.T) {
+	for v, want := range map[string]string{
+		"":                               "",
+		"inline":                         "",
+		`attachment; filename="a b.zip"`: "a b.zip",
+		"attachment; filename=a.zip":     "a.zip",
+		"attachment; filename*=UTF-8''%E4%B8%AD%E6%96%87.zip":                   "中文.zip",
+		`attachment; filename="fallback.zip"; filename*=UTF-8''real%20name.zip`: "real name.zip",
+		`attachment; filename*=UTF-8''real%20name.zip; filename="fallback.zip"`: "real name.zip",
+		"attachment; filename=中文 文件.zip":                                        "中文 文件.zip",
+		`attachment;filename = "raw name.txt"; size=3 ; broken=`:                "raw name.txt",
+	} {
+		if got := dispositionName(v); got != want {
+			t.Errorf("dispositionName(%q) = %q want %q", v, got, want)
+		}
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a.zip", "a.zip"},
+		{"../../etc/passwd", "passwd"},
+		{`..\..\windows\win.ini`, "win.ini"},
+		{"/abs/dir/x.txt", "x.txt"},
+		{"dir/", "dir"},
+		{`a<b>c:d"e|f?g*.txt`, "a_b_c_d_e_f_g_.txt"},
+		{"a\x01b\x7f.txt", "a_b_.txt"},
+		{" .hidden. ", "hidden"},
+		{"中文 文件.mp4", "中文 文件.mp4"},
+		{strings.Repeat("a", 300) + ".mp4", strings.Repeat("a", 196) + ".mp4"},
+		{strings.Repeat("中", 100) + ".txt", strings.Repeat("中", 65) + ".txt"},
+		{strings.Repeat("a", 300) + "." + strings.Repeat("b", 20), strings.Repeat("a", 200)},
+		{"", ""},
+		{"..", ""},
+		{"/", ""},
+		{"?", ""},
+		{" . ", ""},
+	}
+	for _, tt := range tests {
+		got, err := SafeName(tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("SafeName(%q) = %q want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("SafeName(%q) = %q %v want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	tests := []struct {
+		name  string
+		taken []string
+		want  string
+	}{
+		{"a.zip", nil, "a.zip"},
+		{"a.zip", []string{"a.zip"}, "a.1.zip"},
+		{"a.zip", []string{"a.zip", "a.1.zip", "a.2.zip"}, "a.3.zip"},
+		{"a", []string{"a"}, "a.1"},
+		{"a.tar.gz", []string{"a.tar.gz"}, "a.tar.1.gz"},
+	}
+	for _, tt := range tests {
+		taken := map[string]bool{}
+		for _, n := range tt.taken {
+			taken[n] = true
+		}
+		if got := FreeName(tt.name, func(n string) bool { return taken[n] }); got != tt.want {
+			t.Errorf("FreeName(%q) = %q want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExists(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		done = filepath.Join(dir, "done")
+		part = filepath.Join(dir, "part")
+	)
+	for _, f := range []string{done, part, part + StateSuffix} {
+		if err := ioutil.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !Exists(done) || Exists(part) || Exists(filepath.Join(dir, "none")) {
+		t.Fatal("an unfinished or missing download is taken as existing")
+	}
+}
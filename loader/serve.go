@@ -0,0 +1,168 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const serveChunk = 1048576
+
+// Serve start a local http server of the file being downloaded and return its url and a func to stop it
+// downloaded ranges are read from the file, the others are fetched from the remote on demand and written back
+func (l *Loader) Serve() (string, func(), error) {
+	l.mu.Lock()
+	ready := l.state != nil
+	l.mu.Unlock()
+	if !ready {
+		return "", nil, fmt.Errorf("range is not supported")
+	}
+	file, err := os.OpenFile(l.task.Path, os.O_RDWR, 0644)
+	if err != nil {
+		return "", nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		file.Close()
+		return "", nil, err
+	}
+	name := filepath.Base(l.task.Path)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.serveHTTP(w, r, file, name)
+	})}
+	go srv.Serve(ln)
+	stop := func() {
+		srv.Close()
+		file.Close()
+	}
+	return fmt.Sprintf("http://%s/%s", ln.Addr(), url.PathEscape(name)), stop, nil
+}
+
+func (l *Loader) serveHTTP(w http.ResponseWriter, r *http.Request, file *os.File, name string) {
+	var (
+		size       = l.state.Size
+		start, end = int64(0), size - 1
+		status     = http.StatusOK
+	)
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	if v := r.Header.Get("Range"); v != "" {
+		var ok bool
+		if start, end, ok = parseRange(v, size); !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, "invalid range", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	for pos := start; pos <= end; pos += serveChunk {
+		e := pos + serveChunk - 1
+		if e > end {
+			e = end
+		}
+		if err := l.copyRange(w, file, pos, e); err != nil {
+			return
+		}
+	}
+}
+
+// copyRange write remote range [start,end] from the file if downloaded, otherwise from the remote
+func (l *Loader) copyRange(w io.Writer, file *os.File, start int64, end int64) error {
+	if start >= l.state.Start && end <= l.state.End && l.Completed(start, end) {
+		_, err := io.Copy(w, io.NewSectionReader(file, start-l.state.Base, end-start+1))
+		return err
+	}
+	req, err := l.request(l.task.URL, start, end)
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("%s : range %d-%d not supported", resp.Status, start, end)
+	}
+	data := make([]byte, end-start+1)
+	if _, err = io.ReadFull(resp.Body, data); err != nil {
+		return err
+	}
+	if start >= l.state.Start && end <= l.state.End {
+		l.writeBack(file, data, start, end)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeBack save a range fetched for the player into the file so the download does not fetch it again
+func (l *Loader) writeBack(file *os.File, data []byte, start int64, end int64) {
+	if _, err := file.WriteAt(data, start-l.state.Base); err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.finished {
+		return
+	}
+	l.state.add(start, end)
+	if time.Since(l.saved) > saveEvery {
+		l.state.save(l.statePath)
+		l.saved = time.Now()
+	}
+}
+
+// parseRange parse a single range like bytes=0-1023 bytes=1024- or bytes=-500
+func parseRange(v string, size int64) (int64, int64, bool) {
+	if !strings.HasPrefix(v, "bytes=") || strings.Contains(v, ",") {
+		return 0, 0, false
+	}
+	r := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(v, "bytes=")), "-", 2)
+	if len(r) != 2 {
+		return 0, 0, false
+	}
+	var (
+		start, end int64
+		err        error
+	)
+	if r[0] == "" {
+		// 最后 n 个字节
+		n, err := strconv.ParseInt(r[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, size > 0
+	}
+	if start, err = strconv.ParseInt(r[0], 10, 64); err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if r[1] != "" {
+		if end, err = strconv.ParseInt(r[1], 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
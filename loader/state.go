@@ -0,0 +1,146 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// StateSuffix is appended to the file name for the chunk map
+const StateSuffix = ".disk-part"
+
+// State is the chunk map of a unfinished download, ranges are remote offsets and inclusive
+type State struct {
+	URL          string     `json:"url"`
+	Size         int64      `json:"size"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"`
+	Start        int64      `json:"start"`
+	End          int64      `json:"end"`
+	Base         int64      `json:"base"` // remote offset of the first byte of file
+	Done         [][2]int64 `json:"done"`
+}
+
+// loadState read the state file, return nil if not exist
+func loadState(file string) (*State, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &State{}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s is broken: %v", file, err)
+	}
+	return s, nil
+}
+
+// save write the state file atomically
+func (s *State) save(file string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// same report whether the remote content is unchanged
+func (s *State) same(size int64, etag string, lastModified string) bool {
+	if s.Size != size {
+		return false
+	}
+	if s.ETag != "" && etag != "" && s.ETag != etag {
+		return false
+	}
+	if s.LastModified != "" && lastModified != "" && s.LastModified != lastModified {
+		return false
+	}
+	return true
+}
+
+// add mark [start,end] completed and merge ranges
+func (s *State) add(start int64, end int64) {
+	if end < start {
+		return
+	}
+	done := append(s.Done, [2]int64{start, end})
+	sort.Slice(done, func(i, j int) bool {
+		return done[i][0] < done[j][0]
+	})
+	merged := done[:1]
+	for _, r := range done[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1]+1 {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	s.Done = merged
+}
+
+// remove mark [start,end] not completed
+func (s *State) remove(start int64, end int64) {
+	var done [][2]int64
+	for _, r := range s.Done {
+		if r[1] < start || r[0] > end {
+			done = append(done, r)
+			continue
+		}
+		if r[0] < start {
+			done = append(done, [2]int64{r[0], start - 1})
+		}
+		if r[1] > end {
+			done = append(done, [2]int64{end + 1, r[1]})
+		}
+	}
+	s.Done = done
+}
+
+// missing return the ranges in [start,end] not completed
+func (s *State) missing(start int64, end int64) [][2]int64 {
+	var (
+		ranges [][2]int64
+		pos    = start
+	)
+	for _, r := range s.Done {
+		if r[1] < pos {
+			continue
+		}
+		if r[0] > end {
+			break
+		}
+		if r[0] > pos {
+			ranges = append(ranges, [2]int64{pos, r[0] - 1})
+		}
+		pos = r[1] + 1
+	}
+	if pos <= end {
+		ranges = append(ranges, [2]int64{pos, end})
+	}
+	return ranges
+}
+
+// covered report whether [start,end] is completed
+func (s *State) covered(start int64, end int64) bool {
+	return len(s.missing(start, end)) == 0
+}
+
+// completed return the completed bytes in [start,end]
+func (s *State) completed(start int64, end int64) int64 {
+	n := end - start + 1
+	for _, r := range s.missing(start, end) {
+		n -= r[1] - r[0] + 1
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package loader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		done [][2]int64
+		add  [2]int64
+		want [][2]int64
+	}{
+		{"empty", nil, [2]int64{0, 9}, [][2]int64{{0, 9}}},
+		{"invalid", [][2]int64{{0, 9}}, [2]int64{5, 4}, [][2]int64{{0, 9}}},
+		{"adjacent", [][2]int64{{0, 9}}, [2]int64{10, 19}, [][2]int64{{0, 19}}},
+		{"overlap", [][2]int64{{0, 9}}, [2]int64{5, 14}, [][2]int64{{0, 14}}},
+		{"inside", [][2]int64{{0, 9}}, [2]int64{2, 3}, [][2]int64{{0, 9}}},
+		{"gap", [][2]int64{{0, 9}}, [2]int64{20, 29}, [][2]int64{{0, 9}, {20, 29}}},
+		{"before", [][2]int64{{20, 29}}, [2]int64{0, 9}, [][2]int64{{0, 9}, {20, 29}}},
+		{"bridge", [][2]int64{{0, 9}, {20, 29}}, [2]int64{10, 19}, [][2]int64{{0, 29}}},
+		{"cover", [][2]int64{{5, 9}, {20, 29}, {40, 49}}, [2]int64{0, 45}, [][2]int64{{0, 49}}},
+	}
+	for _, tt := range tests {
+		s := &State{Done: tt.done}
+		s.add(tt.add[0], tt.add[1])
+		if !reflect.DeepEqual(s.Done, tt.want) {
+			t.Errorf("%s: add %v got %v want %v", tt.name, tt.add, s.Done, tt.want)
+		}
+	}
+}
+
+func TestStateRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		done   [][2]int64
+		remove [2]int64
+		want   [][2]int64
+	}{
+		{"outside", [][2]int64{{0, 9}}, [2]int64{20, 29}, [][2]int64{{0, 9}}},
+		{"all", [][2]int64{{0, 9}}, [2]int64{0, 9}, nil},
+		{"split", [][2]int64{{0, 29}}, [2]int64{10, 19}, [][2]int64{{0, 9}, {20, 29}}},
+		{"head", [][2]int64{{0, 29}}, [2]int64{0, 9}, [][2]int64{{10, 29}}},
+		{"tail", [][2]int64{{0, 29}}, [2]int64{20, 39}, [][2]int64{{0, 19}}},
+		{"across", [][2]int64{{0, 9}, {20, 29}}, [2]int64{5, 24}, [][2]int64{{0, 4}, {25, 29}}},
+	}
+	for _, tt := range tests {
+		s := &State{Done: tt.done}
+		s.remove(tt.remove[0], tt.remove[1])
+		if !reflect.DeepEqual(s.Done, tt.want) {
+			t.Errorf("%s: remove %v got %v want %v", tt.name, tt.remove, s.Done, tt.want)
+		}
+	}
+}
+
+func TestStateMissing(t *testing.T) {
+	tests := []struct {
+		name       string
+		done       [][2]int64
+		start, end int64
+		want       [][2]int64
+		completed  int64
+	}{
+		{"empty", nil, 0, 99, [][2]int64{{0, 99}}, 0},
+		{"full", [][2]int64{{0, 99}}, 0, 99, nil, 100},
+		{"holes", [][2]int64{{10, 19}, {50, 59}}, 0, 99, [][2]int64{{0, 9}, {20, 49}, {60, 99}}, 20},
+		{"window", [][2]int64{{0, 19}, {50, 59}}, 10, 55, [][2]int64{{20, 49}}, 16},
+		{"after", [][2]int64{{0, 9}}, 20, 29, [][2]int64{{20, 29}}, 0},
+		{"before", [][2]int64{{50, 59}}, 0, 9, [][2]int64{{0, 9}}, 0},
+	}
+	for _, tt := range tests {
+		s := &State{Done: tt.done}
+		if got := s.missing(tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: missing got %v want %v", tt.name, got, tt.want)
+		}
+		if got := s.completed(tt.start, tt.end); got != tt.completed {
+			t.Errorf("%s: completed got %d want %d", tt.name, got, tt.completed)
+		}
+		if got := s.covered(tt.start, tt.end); got != (tt.want == nil) {
+			t.Errorf("%s: covered got %v", tt.name, got)
+		}
+	}
+}
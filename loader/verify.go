@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Pieces are hashes of fixed length parts of the file
+type Pieces struct {
+	Type   string
+	Length int64
+	Hashes []string
+}
+
+// NewHash return hash of metalink names like sha-256 or short names like sha256
+func NewHash(t string) (hash.Hash, error) {
+	switch strings.ToLower(strings.Replace(t, "-", "", 1)) {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash %s", t)
+}
+
+// verifyPieces return the remote ranges whose piece hash mismatch
+func (l *Loader) verifyPieces() ([][2]int64, error) {
+	p := l.task.Pieces
+	if p == nil || p.Length < 1 || l.task.Ranged {
+		return nil, nil
+	}
+	var bad [][2]int64
+	for i, want := range p.Hashes {
+		start := int64(i) * p.Length
+		if start > l.state.End {
+			break
+		}
+		end := start + p.Length - 1
+		if end > l.state.End {
+			end = l.state.End
+		}
+		h, err := NewHash(p.Type)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.Copy(h, io.NewSectionReader(l.file, start-l.state.Base, end-start+1)); err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), want) {
+			bad = append(bad, [2]int64{start, end})
+		}
+	}
+	return bad, nil
+}
+
+// verifyFile check the whole file hashes
+func (l *Loader) verifyFile() error {
+	if l.task.Ranged {
+		return nil
+	}
+	for t, want := range l.task.Hashes {
+		h, err := NewHash(t)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(l.task.Path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		got := hex.EncodeToString(h.Sum(nil))
+		if !strings.EqualFold(got, want) {
+			return fmt.Errorf("%s %s mismatch, want %s got %s", l.task.Path, t, want, got)
+		}
+		if l.task.Progress != nil {
+			fmt.Fprintf(l.task.Progress, "%s %s OK\n", t, got)
+		}
+	}
+	return nil
+}
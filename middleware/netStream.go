@@ -1,10 +1,12 @@
 package middleware
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/suconghou/fastload/multiget"
@@ -16,6 +18,8 @@ import (
 var netroute = []routeInfo{
 	{regexp.MustCompile(`^ls/(.+)$`), ls},
 	{regexp.MustCompile(`^info/(.+)$`), info},
+	{regexp.MustCompile(`^stream/(.+)$`), stream},
+	{regexp.MustCompile(`^thumb/(.+)$`), thumb},
 }
 
 // NetStreamAPI response json data
@@ -26,20 +30,93 @@ func NetStreamAPI(w http.ResponseWriter, r *http.Request, match []string) error
 }
 
 func ls(w http.ResponseWriter, r *http.Request, match []string) error {
-	file := match[1]
-	url := baidudisk.NewClient(config.Cfg.Token, config.Cfg.Root).APILsURL(file)
-	return util.ProxyURL(w, r, url, nil)
+	bc, err := newClient()
+	if err != nil {
+		return err
+	}
+	bc.SetCache(util.CacheDir(), util.CacheTTL())
+	body, err := bc.APILsBody(match[1])
+	return writeJSON(w, body, err)
 }
 
 func info(w http.ResponseWriter, r *http.Request, match []string) error {
-	file := match[1]
-	url := baidudisk.NewClient(config.Cfg.Token, config.Cfg.Root).APIFileInfoURL(file)
+	bc, err := newClient()
+	if err != nil {
+		return err
+	}
+	bc.SetCache(util.CacheDir(), util.CacheTTL())
+	body, err := bc.APIFileInfoBody(match[1])
+	return writeJSON(w, body, err)
+}
+
+// newClient return a client of the config, an encrypted token is decrypted on the first request
+func newClient() (*baidudisk.Bclient, error) {
+	if err := config.Unlock(); err != nil {
+		return nil, err
+	}
+	return baidudisk.NewClient(config.Cfg.Token, config.Cfg.Root), nil
+}
+
+// writeJSON response the api body, error_msg means a bad request
+func writeJSON(w http.ResponseWriter, body []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if bytes.Contains(body, []byte(`"error_msg"`)) {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// stream response the m3u8 of video, ?type=M3U8_AUTO_720 choose the format
+func stream(w http.ResponseWriter, r *http.Request, match []string) error {
+	bc, err := newClient()
+	if err != nil {
+		return err
+	}
+	url := bc.APIStreamingURL(match[1], r.URL.Query().Get("type"))
+	return util.ProxyURL(w, r, url, nil)
+}
+
+// thumb response the thumbnail, ?w=800&h=600 set the size
+func thumb(w http.ResponseWriter, r *http.Request, match []string) error {
+	var (
+		file          = match[1]
+		query         = r.URL.Query()
+		width, height int
+		err           error
+	)
+	for _, v := range []struct {
+		key   string
+		value *int
+	}{{"w", &width}, {"h", &height}} {
+		if s := query.Get(v.key); s != "" {
+			if *v.value, err = strconv.Atoi(s); err != nil {
+				http.Error(w, "invalid "+v.key, http.StatusBadRequest)
+				return nil
+			}
+		}
+	}
+	if width, height, err = baidudisk.ThumbSize(width, height); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	bc, err := newClient()
+	if err != nil {
+		return err
+	}
+	url := bc.APIThumbURL(file, width, height, 100)
 	return util.ProxyURL(w, r, url, nil)
 }
 
 func get(w http.ResponseWriter, r *http.Request, match []string) error {
-	file := match[1]
-	url := baidudisk.NewClient(config.Cfg.Token, config.Cfg.Root).GetDownloadURL(file)
+	bc, err := newClient()
+	if err != nil {
+		return err
+	}
+	url := bc.GetDownloadURL(match[1])
 	url = strings.ReplaceAll(url, "qdall01.baidupcs.com", "qdcu02.baidupcs.com")
 	addr := map[string][]string{
 		"qdall01.baidupcs.com:80": []string{
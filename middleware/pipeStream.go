@@ -3,7 +3,6 @@ package middleware
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -34,8 +33,8 @@ func Proxy(w http.ResponseWriter, r *http.Request) error {
 	return fastload.HTTPProxy(w, r)
 }
 
-// ProxySocks is a http_proxy https_proxy socks proxy server
-func ProxySocks(client net.Conn, dialer proxy.Dialer) error {
+// ProxySocks is a http_proxy https_proxy socks proxy server, limiter is shared by all connections
+func ProxySocks(client net.Conn, dialer proxy.Dialer, limiter *util.Limiter) error {
 	var b [1024]byte
 	n, err := client.Read(b[:])
 	if err != nil {
@@ -64,9 +63,9 @@ func ProxySocks(client net.Conn, dialer proxy.Dialer) error {
 		client.Write([]byte{0x05, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}) //响应客户端连接成功
 		//进行转发
 		p1die := make(chan bool)
-		go func() { io.Copy(server, client); close(p1die) }()
+		go func() { util.LimitCopy(server, client, limiter); close(p1die) }()
 		p2die := make(chan bool)
-		go func() { io.Copy(client, server); close(p2die) }()
+		go func() { util.LimitCopy(client, server, limiter); close(p2die) }()
 		select {
 		case <-p1die:
 		case <-p2die:
@@ -103,9 +102,9 @@ func ProxySocks(client net.Conn, dialer proxy.Dialer) error {
 		}
 	}
 	p1die := make(chan bool)
-	go func() { io.Copy(server, client); close(p1die) }()
+	go func() { util.LimitCopy(server, client, limiter); close(p1die) }()
 	p2die := make(chan bool)
-	go func() { io.Copy(client, server); close(p2die) }()
+	go func() { util.LimitCopy(client, server, limiter); close(p2die) }()
 	select {
 	case <-p1die:
 	case <-p2die:
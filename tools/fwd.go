@@ -2,7 +2,6 @@ package tools
 
 import (
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"sync"
@@ -21,6 +20,10 @@ func FwdMain() error {
 	if len(os.Args) > 3 {
 		if utilgo.IsIPPort(os.Args[2]) && utilgo.IsIPPort(os.Args[3]) {
 			proto := utilgo.BoolString(utilgo.HasFlag(os.Args, "-u"), "udp", "tcp")
+			limiter, err := util.GetLimiter()
+			if err != nil {
+				return err
+			}
 			l, err := net.Listen(proto, os.Args[2])
 			if err != nil {
 				return err
@@ -30,14 +33,14 @@ func FwdMain() error {
 				if err != nil {
 					return err
 				}
-				go streamCopy(conn, os.Args[3], proto)
+				go streamCopy(conn, os.Args[3], proto, limiter)
 			}
 		}
 	}
 	return fmt.Errorf("args error")
 }
 
-func streamCopy(conn net.Conn, remote string, proto string) {
+func streamCopy(conn net.Conn, remote string, proto string, limiter *util.Limiter) {
 
 	var (
 		c   net.Conn
@@ -62,8 +65,8 @@ func streamCopy(conn net.Conn, remote string, proto string) {
 	}
 	if err == nil {
 		wg.Add(2)
-		go func() { io.Copy(conn, c); wg.Done() }()
-		go func() { io.Copy(c, conn); wg.Done() }()
+		go func() { util.LimitCopy(conn, c, limiter); wg.Done() }()
+		go func() { util.LimitCopy(c, conn, limiter); wg.Done() }()
 		wg.Wait()
 		conn.Close()
 		c.Close()
@@ -9,9 +9,22 @@ import (
 	"github.com/suconghou/utilgo"
 )
 
-// HTTPProxy nginx like reverse proxy
-func HTTPProxy(port int, url string, transport *http.Transport, str string) error {
+type limitResponseWriter struct {
+	http.ResponseWriter
+	limiter *util.Limiter
+}
+
+func (w *limitResponseWriter) Write(p []byte) (int, error) {
+	w.limiter.Wait(len(p))
+	return w.ResponseWriter.Write(p)
+}
+
+// HTTPProxy nginx like reverse proxy, limiter is shared by all responses
+func HTTPProxy(port int, url string, transport *http.Transport, str string, limiter *util.Limiter) error {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if limiter != nil {
+			w = &limitResponseWriter{w, limiter}
+		}
 		if r.Method == "OPTIONS" {
 			utilgo.CrossShare(w.Header(), r.Header, str)
 			http.Error(w, "ok", http.StatusOK)
@@ -0,0 +1,367 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/suconghou/netdisk/loader"
+	"github.com/suconghou/netdisk/util"
+	"golang.org/x/net/html"
+)
+
+const maxPageSize = 64 << 20
+
+// MirrorOption control the recursive download
+type MirrorOption struct {
+	Depth     int    // levels of pages to follow, 0 means unlimited
+	Dir       string // files are saved under Dir/host/
+	NoParent  bool   // only follow pages under the dir of the start url
+	NoRobots  bool
+	Workers   int
+	Large     int64 // files larger than this are downloaded by Load
+	Header    http.Header
+	Transport *http.Transport
+	Load      func(url string, saveas string) error
+}
+
+type mirrorLink struct {
+	u     *url.URL
+	depth int
+	asset bool
+}
+
+type mirrorPage struct {
+	local string
+	base  *url.URL
+}
+
+type siteMirror struct {
+	opt     *MirrorOption
+	root    *url.URL
+	prefix  string
+	client  *http.Client
+	robots  *robots
+	mu      sync.Mutex
+	visited map[string]bool
+	saved   map[string]string // url to local file
+	pages   []mirrorPage
+	files   int
+	failed  int
+}
+
+// Mirror download the pages and assets of site recursively and rewrite links for local browsing
+func Mirror(site string, opt *MirrorOption) error {
+	root, err := url.Parse(site)
+	if err != nil || (root.Scheme != "http" && root.Scheme != "https") || root.Host == "" {
+		return fmt.Errorf("invalid url %s", site)
+	}
+	root.Fragment = ""
+	if opt.Workers < 1 {
+		opt.Workers = 1
+	}
+	m := &siteMirror{
+		opt:     opt,
+		root:    root,
+		prefix:  root.Path[:strings.LastIndex(root.Path, "/")+1],
+		client:  &http.Client{},
+		visited: map[string]bool{linkKey(root): true},
+		saved:   map[string]string{},
+	}
+	if opt.Transport != nil {
+		m.client.Transport = opt.Transport
+	}
+	if !opt.NoRobots {
+		m.robots = loadRobots(m.client, root.Scheme+"://"+root.Host, opt.Header)
+	}
+	level := []mirrorLink{{u: root}}
+	for len(level) > 0 {
+		var (
+			next []mirrorLink
+			wg   sync.WaitGroup
+			sem  = make(chan struct{}, opt.Workers)
+		)
+		for _, l := range level {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(l mirrorLink) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				links, err := m.fetch(l)
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				if err != nil {
+					m.failed++
+					util.Log.Printf("失败 %s : %v", l.u, err)
+					return
+				}
+				m.files++
+				for _, n := range links {
+					if k := linkKey(n.u); !m.visited[k] && m.follow(n) {
+						m.visited[k] = true
+						next = append(next, n)
+					}
+				}
+			}(l)
+		}
+		wg.Wait()
+		level = next
+	}
+	for _, p := range m.pages {
+		if err = m.rewrite(p); err != nil {
+			util.Log.Printf("失败 %s : %v", p.local, err)
+		}
+	}
+	util.Log.Printf("共 %d 个文件 %d 个失败", m.files+m.failed, m.failed)
+	if m.failed > 0 {
+		return fmt.Errorf("%d files failed", m.failed)
+	}
+	return nil
+}
+
+// follow report whether the link is in scope and allowed
+func (m *siteMirror) follow(l mirrorLink) bool {
+	if l.u.Host != m.root.Host {
+		return false
+	}
+	if !l.asset {
+		if m.opt.Depth > 0 && l.depth > m.opt.Depth {
+			return false
+		}
+		if m.opt.NoParent && !strings.HasPrefix(l.u.Path, m.prefix) {
+			return false
+		}
+	}
+	return m.robots.allowed(l.u.RequestURI())
+}
+
+// fetch save one url, return the links of html page
+func (m *siteMirror) fetch(l mirrorLink) ([]mirrorLink, error) {
+	req, err := http.NewRequest(http.MethodGet, l.u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range m.opt.Header {
+		req.Header[k] = v
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	var (
+		ct, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		isHTML   = ct == "text/html" || ct == "application/xhtml+xml"
+		local    = m.localPath(l.u, isHTML)
+		final    = resp.Request.URL
+	)
+	if err = os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.saved[linkKey(l.u)] = local
+	m.saved[linkKey(final)] = local
+	m.visited[linkKey(final)] = true
+	m.mu.Unlock()
+	util.Log.Printf("%s -> %s", l.u, local)
+	if !isHTML {
+		if m.opt.Load != nil && m.opt.Large > 0 && resp.ContentLength > m.opt.Large {
+			resp.Body.Close()
+			return nil, m.opt.Load(l.u.String(), local)
+		}
+		f, err := os.Create(local)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, resp.Body)
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(local, data, 0644); err != nil {
+		return nil, err
+	}
+	var links []mirrorLink
+	walkLinks(data, final, false, func(u *url.URL, asset bool) string {
+		links = append(links, mirrorLink{u: u, depth: l.depth + 1, asset: asset})
+		return ""
+	})
+	m.mu.Lock()
+	m.pages = append(m.pages, mirrorPage{local: local, base: final})
+	m.mu.Unlock()
+	return links, nil
+}
+
+// rewrite point the links of a saved page to the local files, other links become absolute
+func (m *siteMirror) rewrite(p mirrorPage) error {
+	data, err := ioutil.ReadFile(p.local)
+	if err != nil {
+		return err
+	}
+	data = walkLinks(data, p.base, true, func(u *url.URL, asset bool) string {
+		local, ok := m.saved[linkKey(u)]
+		if !ok {
+			return u.String()
+		}
+		rel, err := filepath.Rel(filepath.Dir(p.local), local)
+		if err != nil {
+			return u.String()
+		}
+		if u.Fragment != "" {
+			return filepath.ToSlash(rel) + "#" + u.Fragment
+		}
+		return filepath.ToSlash(rel)
+	})
+	return ioutil.WriteFile(p.local, data, 0644)
+}
+
+// localPath map url to Dir/host/path, pages without html extension get one
+func (m *siteMirror) localPath(u *url.URL, isHTML bool) string {
+	p := u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index.html"
+	}
+	if u.RawQuery != "" {
+		p += "@" + u.RawQuery
+	}
+	if ext := strings.ToLower(path.Ext(p)); isHTML && ext != ".html" && ext != ".htm" {
+		p += ".html"
+	}
+	parts := []string{m.opt.Dir, strings.Replace(u.Host, ":", "_", -1)}
+	for _, s := range strings.Split(path.Clean("/"+p), "/") {
+		if s == "" {
+			continue
+		}
+		name, err := loader.SafeName(s)
+		if err != nil {
+			name = "_"
+		}
+		parts = append(parts, name)
+	}
+	return filepath.Join(parts...)
+}
+
+// linkKey is the url without fragment
+func linkKey(u *url.URL) string {
+	c := *u
+	c.Fragment = ""
+	return c.String()
+}
+
+// linkAttr report whether attr of tag is a link and whether it is an asset of the page
+func linkAttr(t html.Token, key string) (bool, bool) {
+	switch t.Data + "." + key {
+	case "a.href", "area.href", "iframe.src", "frame.src":
+		return true, false
+	case "img.src", "img.srcset", "script.src", "embed.src", "track.src", "audio.src", "video.src", "video.poster", "source.src", "source.srcset", "object.data":
+		return true, true
+	case "link.href":
+		for _, a := range t.Attr {
+			if a.Key == "rel" {
+				rel := strings.ToLower(a.Val)
+				return strings.Contains(rel, "stylesheet") || strings.Contains(rel, "icon") || strings.Contains(rel, "preload") || strings.Contains(rel, "manifest"), true
+			}
+		}
+	}
+	return false, false
+}
+
+// walkLinks call fn with each link of the page, a non empty return replaces the link
+// base tag is dropped when rewriting because links are made relative to the file
+func walkLinks(data []byte, base *url.URL, rewrite bool, fn func(u *url.URL, asset bool) string) []byte {
+	var (
+		out bytes.Buffer
+		z   = html.NewTokenizer(bytes.NewReader(data))
+	)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out.Bytes()
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(raw)
+			continue
+		}
+		var (
+			t       = z.Token()
+			changed bool
+		)
+		if t.Data == "base" {
+			for _, a := range t.Attr {
+				if u := resolveLink(base, a.Val); a.Key == "href" && u != nil {
+					base = u
+				}
+			}
+			if rewrite {
+				continue
+			}
+		}
+		for i, a := range t.Attr {
+			ok, asset := linkAttr(t, a.Key)
+			if !ok {
+				continue
+			}
+			val := a.Val
+			if strings.HasSuffix(a.Key, "srcset") {
+				var items []string
+				for _, item := range strings.Split(a.Val, ",") {
+					fields := strings.Fields(item)
+					if len(fields) == 0 {
+						continue
+					}
+					if u := resolveLink(base, fields[0]); u != nil {
+						if r := fn(u, asset); r != "" {
+							fields[0] = r
+						}
+					}
+					items = append(items, strings.Join(fields, " "))
+				}
+				val = strings.Join(items, ", ")
+			} else if u := resolveLink(base, a.Val); u != nil {
+				if r := fn(u, asset); r != "" {
+					val = r
+				}
+			}
+			if val != a.Val {
+				t.Attr[i].Val = val
+				changed = true
+			}
+		}
+		if changed {
+			out.WriteString(t.String())
+		} else {
+			out.Write(raw)
+		}
+	}
+}
+
+// resolveLink return the absolute http url of link, nil for fragments and other schemes
+func resolveLink(base *url.URL, link string) *url.URL {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return nil
+	}
+	u, err := base.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	return u
+}
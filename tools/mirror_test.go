@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var mirrorSite = map[string]string{
+	"/robots.txt":       "User-agent: *\nDisallow: /docs/secret\nDisallow: /*.pdf$\n",
+	"/docs/index.html":  `<a href="page1.html">1</a> <a href="/other/out.html">out</a> <a href="secret.html">s</a> <a href="file.pdf">pdf</a> <a href="http://example.invalid/x">ext</a> <img src="/static/logo.png">`,
+	"/docs/page1.html":  `<a href="page2.html#top">2</a> <a href="index.html">back</a>`,
+	"/docs/page2.html":  `<a href="page3.html">3</a>`,
+	"/docs/page3.html":  `end`,
+	"/docs/secret.html": `secret`,
+	"/docs/file.pdf":    `pdf`,
+	"/other/out.html":   `out`,
+	"/static/logo.png":  `png`,
+}
+
+func TestMirror(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		requested = map[string]bool{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		body, ok := mirrorSite[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	if err := Mirror(ts.URL+"/docs/index.html", &MirrorOption{Depth: 2, Dir: dir, NoParent: true, Workers: 2}); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(ts.URL)
+	site := filepath.Join(dir, strings.Replace(u.Host, ":", "_", -1))
+	for _, p := range []string{"docs/index.html", "docs/page1.html", "docs/page2.html", "static/logo.png"} {
+		if _, err := os.Stat(filepath.Join(site, p)); err != nil {
+			t.Errorf("%s not saved: %v", p, err)
+		}
+	}
+	for p, why := range map[string]string{
+		"/docs/page3.html":  "deeper than the depth",
+		"/other/out.html":   "outside the start dir",
+		"/docs/secret.html": "disallowed by robots.txt",
+		"/docs/file.pdf":    "disallowed by a wildcard rule",
+	} {
+		if requested[p] {
+			t.Errorf("%s is fetched but %s", p, why)
+		}
+	}
+	index, err := ioutil.ReadFile(filepath.Join(site, "docs/index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`href="page1.html"`, `src="../static/logo.png"`, `href="` + ts.URL + `/other/out.html"`, `href="http://example.invalid/x"`} {
+		if !strings.Contains(string(index), want) {
+			t.Errorf("index.html has no %s: %s", want, index)
+		}
+	}
+	page1, _ := ioutil.ReadFile(filepath.Join(site, "docs/page1.html"))
+	if !strings.Contains(string(page1), `href="page2.html#top"`) {
+		t.Errorf("fragment not kept: %s", page1)
+	}
+	page2, _ := ioutil.ReadFile(filepath.Join(site, "docs/page2.html"))
+	if !strings.Contains(string(page2), `href="`+ts.URL+`/docs/page3.html"`) {
+		t.Errorf("link out of depth is not absolute: %s", page2)
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		rule, path string
+		want       bool
+	}{
+		{"/docs", "/docs/a.html", true},
+		{"/docs", "/doc", false},
+		{"/*.pdf", "/a/b.pdf", true},
+		{"/*.pdf", "/a/b.pdf?x=1", true},
+		{"/*.pdf$", "/a/b.pdf", true},
+		{"/*.pdf$", "/a/b.pdf?x=1", false},
+		{"/a*b$", "/axbxb", true},
+		{"/a*b$", "/axbx", false},
+		{"/index.html$", "/index.html", true},
+		{"/index.html$", "/index.html?a", false},
+		{"/*/private/", "/u/private/x", true},
+		{"/*/private/", "/u/public/x", false},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.rule, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v want %v", tt.rule, tt.path, got, tt.want)
+		}
+	}
+	rb := parseRobots(strings.NewReader("User-agent: other\nDisallow: /\n\nUser-agent: *\nDisallow: /docs/\nAllow: /docs/public\n"))
+	for path, want := range map[string]bool{"/": true, "/docs/a": false, "/docs/public/a": true} {
+		if got := rb.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v want %v", path, got, want)
+		}
+	}
+}
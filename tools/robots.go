@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// robots is the rules of robots.txt for all user agents
+type robots struct {
+	allow    []string
+	disallow []string
+}
+
+// loadRobots fetch robots.txt of site, nil means everything is allowed
+func loadRobots(client *http.Client, site string, header http.Header) *robots {
+	req, err := http.NewRequest(http.MethodGet, site+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, 512*1024))
+}
+
+// parseRobots read the group of User-agent: *
+func parseRobots(r io.Reader) *robots {
+	var (
+		rb      = &robots{}
+		scanner = bufio.NewScanner(r)
+		match   bool
+		agents  bool // the previous line is User-agent, consecutive agents share one group
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+		switch key {
+		case "user-agent":
+			if !agents {
+				match = false
+			}
+			agents = true
+			if value == "*" {
+				match = true
+			}
+		case "allow", "disallow":
+			agents = false
+			if !match || value == "" {
+				continue
+			}
+			if key == "allow" {
+				rb.allow = append(rb.allow, value)
+			} else {
+				rb.disallow = append(rb.disallow, value)
+			}
+		default:
+			agents = false
+		}
+	}
+	return rb
+}
+
+// allowed report whether path is allowed, the longest matched rule wins
+func (rb *robots) allowed(path string) bool {
+	if rb == nil {
+		return true
+	}
+	var allow, disallow int
+	for _, p := range rb.allow {
+		if len(p) > allow && robotsMatch(p, path) {
+			allow = len(p)
+		}
+	}
+	for _, p := range rb.disallow {
+		if len(p) > disallow && robotsMatch(p, path) {
+			disallow = len(p)
+		}
+	}
+	return disallow == 0 || allow >= disallow
+}
+
+// robotsMatch match a path prefix rule, * matches any characters and a trailing $ anchors the end
+func robotsMatch(rule string, path string) bool {
+	anchored := strings.HasSuffix(rule, "$")
+	if anchored {
+		rule = rule[:len(rule)-1]
+	}
+	parts := strings.Split(rule, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+	for i, p := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, p)
+		}
+		j := strings.Index(rest, p)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(p):]
+	}
+	return true
+}
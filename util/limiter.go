@@ -0,0 +1,154 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/suconghou/netdisk/config"
+	"github.com/suconghou/utilgo"
+)
+
+// Limiter is a token bucket shared by several transfers, a nil Limiter does not limit
+type Limiter struct {
+	mu       sync.Mutex
+	schedule []rateSlot
+	tokens   float64
+	last     time.Time
+}
+
+// rateSlot is the rate from minute of the day until the next slot
+type rateSlot struct {
+	minute int
+	rate   float64 // bytes per second, 0 means unlimited
+}
+
+// NewLimiter return a Limiter of rate bytes per second
+func NewLimiter(rate uint64) *Limiter {
+	return &Limiter{schedule: []rateSlot{{0, float64(rate)}}, tokens: float64(rate), last: time.Now()}
+}
+
+// ParseLimiter parse a rate like 2M or a timetable like "08:00,512K 19:00,off", empty means the config default
+// return nil if unlimited
+func ParseLimiter(str string) (*Limiter, error) {
+	if str == "" {
+		str = config.Cfg.LimitRate
+	}
+	str = strings.TrimSpace(str)
+	if str == "" || str == "off" || str == "0" {
+		return nil, nil
+	}
+	if !strings.Contains(str, ",") {
+		rate, err := ParseSize(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate %s , should be like 500K or 2M", str)
+		}
+		return NewLimiter(rate), nil
+	}
+	var schedule []rateSlot
+	for _, item := range strings.Fields(str) {
+		kv := strings.SplitN(item, ",", 2)
+		var h, m int
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid timetable %s , should be like 08:00,512K", item)
+		}
+		if n, err := fmt.Sscanf(kv[0], "%d:%d", &h, &m); err != nil || n != 2 || h < 0 || h > 23 || m < 0 || m > 59 {
+			return nil, fmt.Errorf("invalid time %s , should be like 08:00", kv[0])
+		}
+		var rate uint64
+		if kv[1] != "off" {
+			var err error
+			if rate, err = ParseSize(kv[1]); err != nil {
+				return nil, fmt.Errorf("invalid rate %s , should be like 500K 2M or off", kv[1])
+			}
+		}
+		schedule = append(schedule, rateSlot{h*60 + m, float64(rate)})
+	}
+	sort.Slice(schedule, func(i, j int) bool {
+		return schedule[i].minute < schedule[j].minute
+	})
+	return &Limiter{schedule: schedule, last: time.Now()}, nil
+}
+
+// GetLimiter return the Limiter of --limit-rate or the config default
+func GetLimiter() (*Limiter, error) {
+	var str string
+	if utilgo.HasFlag(os.Args, "--limit-rate") {
+		var err error
+		if str, err = utilgo.GetParam(os.Args, "--limit-rate"); err != nil || str == "" {
+			return nil, fmt.Errorf("--limit-rate needs a rate like 2M or off")
+		}
+	}
+	return ParseLimiter(str)
+}
+
+// rate return the rate at t, the last slot of the day continues after midnight
+func (l *Limiter) rate(t time.Time) float64 {
+	var (
+		minute = t.Hour()*60 + t.Minute()
+		rate   = l.schedule[len(l.schedule)-1].rate
+	)
+	for _, s := range l.schedule {
+		if s.minute > minute {
+			break
+		}
+		rate = s.rate
+	}
+	return rate
+}
+
+// Wait block until n bytes are allowed
+func (l *Limiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	rate := l.rate(now)
+	if rate <= 0 {
+		l.tokens, l.last = 0, now
+		l.mu.Unlock()
+		return
+	}
+	l.tokens += now.Sub(l.last).Seconds() * rate
+	if l.tokens > rate {
+		l.tokens = rate
+	}
+	l.last = now
+	// 令牌不足时预支, 按欠下的字节数等待
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+type limitReader struct {
+	r io.Reader
+	l *Limiter
+}
+
+// LimitReader return a reader whose read speed is limited by l
+func LimitReader(r io.Reader, l *Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitReader{r: r, l: l}
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.l.Wait(n)
+	return n, err
+}
+
+// LimitCopy copy src to dst with the speed limited by l
+func LimitCopy(dst io.Writer, src io.Reader, l *Limiter) (int64, error) {
+	return io.Copy(dst, LimitReader(src, l))
+}
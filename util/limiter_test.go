@@ -0,0 +1,115 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/suconghou/netdisk/config"
+)
+
+func TestParseLimiter(t *testing.T) {
+	config.Cfg.LimitRate = ""
+	tests := []struct {
+		str       string
+		unlimited bool
+		schedule  []rateSlot
+		err       string
+	}{
+		{str: "", unlimited: true},
+		{str: "off", unlimited: true},
+		{str: " 0 ", unlimited: true},
+		{str: "2M", schedule: []rateSlot{{0, 2 << 20}}},
+		{str: "500k", schedule: []rateSlot{{0, 500 << 10}}},
+		{str: "19:00,off 08:30,512K", schedule: []rateSlot{{8*60 + 30, 512 << 10}, {19 * 60, 0}}},
+		{str: "00:00,1M", schedule: []rateSlot{{0, 1 << 20}}},
+		{str: "fast", err: "invalid rate fast , should be like 500K or 2M"},
+		{str: "08:00", err: "invalid rate 08:00 , should be like 500K or 2M"},
+		{str: "08:00,1M 19:00", err: "invalid timetable 19:00 , should be like 08:00,512K"},
+		{str: "24:00,1M", err: "invalid time 24:00 , should be like 08:00"},
+		{str: "08:60,1M", err: "invalid time 08:60 , should be like 08:00"},
+		{str: "8h,1M", err: "invalid time 8h , should be like 08:00"},
+		{str: "08:00,fast", err: "invalid rate fast , should be like 500K 2M or off"},
+	}
+	for _, tt := range tests {
+		l, err := ParseLimiter(tt.str)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: got error %v want %s", tt.str, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.str, err)
+			continue
+		}
+		if tt.unlimited {
+			if l != nil {
+				t.Errorf("%q: got a limiter, want unlimited", tt.str)
+			}
+			continue
+		}
+		if l == nil || len(l.schedule) != len(tt.schedule) {
+			t.Errorf("%q: got %+v want %v", tt.str, l, tt.schedule)
+			continue
+		}
+		for i := range tt.schedule {
+			if l.schedule[i] != tt.schedule[i] {
+				t.Errorf("%q: slot %d is %v want %v", tt.str, i, l.schedule[i], tt.schedule[i])
+			}
+		}
+	}
+	config.Cfg.LimitRate = "1M"
+	if l, err := ParseLimiter(""); err != nil || l == nil || l.schedule[0].rate != 1<<20 {
+		t.Errorf("config default is not used: %+v %v", l, err)
+	}
+	config.Cfg.LimitRate = ""
+}
+
+func TestLimiterRate(t *testing.T) {
+	l, err := ParseLimiter("08:00,512K 19:00,off 12:30,1M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		hour, minute int
+		want         float64
+	}{
+		{0, 0, 0}, // 午夜后沿用前一天最后的时段
+		{7, 59, 0},
+		{8, 0, 512 << 10},
+		{12, 29, 512 << 10},
+		{12, 30, 1 << 20},
+		{18, 59, 1 << 20},
+		{19, 0, 0},
+		{23, 59, 0},
+	}
+	for _, tt := range tests {
+		at := time.Date(2020, 1, 1, tt.hour, tt.minute, 0, 0, time.Local)
+		if got := l.rate(at); got != tt.want {
+			t.Errorf("%02d:%02d: rate %v want %v", tt.hour, tt.minute, got, tt.want)
+		}
+	}
+	wrap, _ := ParseLimiter("22:00,1M 06:00,off")
+	if got := wrap.rate(time.Date(2020, 1, 1, 3, 0, 0, 0, time.Local)); got != 1<<20 {
+		t.Errorf("03:00 in the 22:00 slot: rate %v", got)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	var unlimited *Limiter
+	start := time.Now()
+	unlimited.Wait(1 << 30)
+	off, _ := ParseLimiter("00:00,off")
+	off.Wait(1 << 30)
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Fatalf("unlimited wait took %v", d)
+	}
+	l := NewLimiter(1 << 20)
+	start = time.Now()
+	// 初始令牌允许一秒的量, 再多 200K 需要约 200ms
+	l.Wait(1 << 20)
+	l.Wait(200 << 10)
+	if d := time.Since(start); d < 150*time.Millisecond || d > time.Second {
+		t.Fatalf("1.2M at 1M/s took %v", d)
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// defaultPlayers are tried in order when no player is configured
+var defaultPlayers = []string{"mpv", "vlc", "ffplay", "mplayer"}
+
+func init() {
+	// windows 上优先使用 PotPlayer, 和以前的行为一致
+	if runtime.GOOS == "windows" {
+		defaultPlayers = append([]string{"PotPlayerMini64.exe", "PotPlayerMini.exe"}, defaultPlayers...)
+	}
+}
+
+// StartPlayer run the player command template, {url} and {file} are replaced, target is appended if none is used
+// return nil if no player is configured or found
+func StartPlayer(tpl string, url string, file string) (*exec.Cmd, error) {
+	args := SplitArgs(tpl)
+	if len(args) == 0 {
+		for _, p := range defaultPlayers {
+			if _, err := exec.LookPath(p); err == nil {
+				args = []string{p}
+				break
+			}
+		}
+		if len(args) == 0 {
+			return nil, nil
+		}
+	}
+	var (
+		used   bool
+		target = url
+	)
+	if target == "" {
+		target = file
+	}
+	for i, arg := range args {
+		if strings.Contains(arg, "{url}") || strings.Contains(arg, "{file}") {
+			args[i] = strings.NewReplacer("{url}", target, "{file}", file).Replace(arg)
+			used = true
+		}
+	}
+	if !used {
+		args = append(args, target)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start player %s : %v", args[0], err)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const rangeRetry = 3
+
+type rangeResult struct {
+	data []byte
+	err  error
+}
+
+// RangeReader read a byte range of url with several connections, data is returned in order
+type RangeReader struct {
+	url       string
+	header    http.Header
+	client    *http.Client
+	results   chan chan rangeResult
+	done      chan struct{}
+	closeOnce sync.Once
+	buf       []byte
+	err       error
+}
+
+// NewRangeReader fetch [start,end] of url, chunks are fetched by threads connections
+func NewRangeReader(url string, start int64, end int64, threads int, chunk int64, header http.Header, transport *http.Transport) *RangeReader {
+	if threads < 1 {
+		threads = 1
+	}
+	if chunk < 1 {
+		chunk = 1 << 20
+	}
+	r := &RangeReader{
+		url:     url,
+		header:  header,
+		client:  &http.Client{Timeout: 5 * time.Minute},
+		results: make(chan chan rangeResult, threads),
+		done:    make(chan struct{}),
+	}
+	if transport != nil {
+		r.client.Transport = transport
+	}
+	go func() {
+		defer close(r.results)
+		for s := start; s <= end; s += chunk {
+			e := s + chunk - 1
+			if e > end {
+				e = end
+			}
+			c := make(chan rangeResult, 1)
+			select {
+			case r.results <- c:
+			case <-r.done:
+				return
+			}
+			go func(s int64, e int64) {
+				data, err := r.fetch(s, e)
+				c <- rangeResult{data, err}
+			}(s, e)
+		}
+	}()
+	return r
+}
+
+func (r *RangeReader) fetch(start int64, end int64) ([]byte, error) {
+	var err error
+	for i := 0; i < rangeRetry; i++ {
+		var data []byte
+		if data, err = r.get(start, end); err == nil {
+			return data, nil
+		}
+		select {
+		case <-r.done:
+			return nil, err
+		case <-time.After(time.Second * time.Duration(i+1)):
+		}
+	}
+	return nil, err
+}
+
+func (r *RangeReader) get(start int64, end int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("%s : range %d-%d not supported", resp.Status, start, end)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-start+1 {
+		return nil, fmt.Errorf("range %d-%d got %d bytes", start, end, len(data))
+	}
+	return data, nil
+}
+
+func (r *RangeReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		c, ok := <-r.results
+		if !ok {
+			r.err = io.EOF
+			return 0, r.err
+		}
+		res := <-c
+		r.buf, r.err = res.data, res.err
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close stop fetching the remain chunks
+func (r *RangeReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/suconghou/netdisk/config"
+)
+
+var tokenParam = regexp.MustCompile(`(access_token=)[^&\s"']+`)
+
+// redactWriter hide the secrets of the config and access_token of urls
+type redactWriter struct {
+	w io.Writer
+}
+
+// Redact return a writer which hides the secrets before writing to w
+func Redact(w io.Writer) io.Writer {
+	return redactWriter{w: w}
+}
+
+// RedactString hide the secrets in s
+func RedactString(s string) string {
+	for _, secret := range config.Secrets() {
+		// 过短的值替换会误伤正常输出
+		if len(secret) >= 6 {
+			s = strings.ReplaceAll(s, secret, "***")
+		}
+	}
+	return tokenParam.ReplaceAllString(s, "${1}***")
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, RedactString(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
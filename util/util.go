@@ -2,20 +2,34 @@ package util
 
 import (
 	"crypto/tls"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/suconghou/netdisk/config"
 	"github.com/suconghou/utilgo"
 	"golang.org/x/net/proxy"
 )
 
-// Log is a global logger
-var Log = log.New(os.Stdout, "", 0)
+// Log is a global logger, the secrets are hidden
+var Log = log.New(Redact(os.Stdout), "", 0)
 
 // Debug log to stderr
-var Debug = log.New(os.Stderr, "", log.Lshortfile|log.LstdFlags)
+var Debug = log.New(Redact(os.Stderr), "", log.Lshortfile|log.LstdFlags)
+
+// Warn log to stderr the errors which do not stop the command
+var Warn = log.New(Redact(os.Stderr), "", 0)
+
+// Raw print what the user asks for explicitly, like a download link with the token
+var Raw = log.New(os.Stdout, "", 0)
 
 // MakeSocksProxy return socks proxy Transport
 func MakeSocksProxy(str string, tlsCfg *tls.Config) (*http.Transport, error) {
@@ -67,3 +81,183 @@ func GetProxy() (*http.Transport, error) {
 	}
 	return nil, nil
 }
+
+// ParseFormat pick --json and --format out of os.Args and return the output format
+func ParseFormat() string {
+	var (
+		format string
+		args   = make([]string, 0, len(os.Args))
+	)
+	for i := 0; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--json":
+			format = "json"
+		case "--format":
+			if i+1 < len(os.Args) {
+				i++
+				format = os.Args[i]
+			}
+		default:
+			args = append(args, os.Args[i])
+		}
+	}
+	os.Args = args
+	return format
+}
+
+// PickFlag remove the bool flag from os.Args and report whether it was given
+func PickFlag(name string) bool {
+	var (
+		found bool
+		args  = make([]string, 0, len(os.Args))
+	)
+	for _, arg := range os.Args {
+		if arg == name {
+			found = true
+		} else {
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+	return found
+}
+
+// CacheDir return the cache dir of the app under the user cache dir
+func CacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "netdisk")
+}
+
+// CacheTTL return how long the ls and meta responses are cached
+func CacheTTL() time.Duration {
+	switch {
+	case config.Cfg.CacheTTL < 0:
+		return 0
+	case config.Cfg.CacheTTL == 0:
+		return 30 * time.Second
+	}
+	return time.Duration(config.Cfg.CacheTTL) * time.Second
+}
+
+// ParseSize parse size like 1024 512K 2M 1.5G
+func ParseSize(str string) (uint64, error) {
+	s := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(str)), "B"), "I")
+	unit := uint64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			s = s[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %s", str)
+	}
+	return uint64(f * float64(unit)), nil
+}
+
+// ParseTime parse date like 2006-01-02 or age like 30d 2w 1y 12h, return unix time
+func ParseTime(str string) (int64, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+	if n := len(str); n > 1 {
+		if unit, ok := units[str[n-1]]; ok {
+			if v, err := strconv.ParseFloat(str[:n-1], 64); err == nil && v >= 0 {
+				return time.Now().Add(-time.Duration(v * float64(unit))).Unix(), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid time %s , use 2006-01-02 or age like 30d 1y", str)
+}
+
+// SplitArgs split a line like shell, quotes and \ escapes are supported
+func SplitArgs(line string) []string {
+	var (
+		args    []string
+		b       strings.Builder
+		quote   rune
+		escaped bool
+		inWord  bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, b.String())
+				b.Reset()
+				inWord = false
+			}
+		default:
+			b.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, b.String())
+	}
+	return args
+}
+
+// NaturalLess compare strings with digit runs compared by number, like ep2 < ep10
+func NaturalLess(a string, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		ra, sa := utf8.DecodeRuneInString(a)
+		rb, sb := utf8.DecodeRuneInString(b)
+		if la, lb := unicode.ToLower(ra), unicode.ToLower(rb); la != lb {
+			return la < lb
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	return len(a) < len(b)
+}
+
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}